@@ -0,0 +1,53 @@
+// Command backfill-rollups rebuilds hourly click rollups from stored
+// clicks, for ranges from before the worker maintained them:
+//
+//	backfill-rollups -since 2026-01-01T00:00:00Z [-until 2026-10-01T00:00:00Z]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/worker"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	sinceFlag := flag.String("since", "", "first hour to rebuild (RFC 3339, required)")
+	untilFlag := flag.String("until", "", "end of the range, exclusive (RFC 3339, default the start of the previous hour)")
+	flag.Parse()
+
+	if err := observability.InitializeZap(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer observability.Logger.Sync()
+
+	since, err := time.Parse(time.RFC3339, *sinceFlag)
+	if err != nil {
+		observability.Logger.Fatal("Invalid -since", zap.Error(err))
+	}
+	until := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	if *untilFlag != "" {
+		if until, err = time.Parse(time.RFC3339, *untilFlag); err != nil {
+			observability.Logger.Fatal("Invalid -until", zap.Error(err))
+		}
+	}
+
+	cfg := config.Load()
+	db.InitPostgres(cfg.DatabaseURL)
+
+	rows, err := worker.BackfillRollups(context.Background(), since, until)
+	if err != nil {
+		observability.Logger.Fatal("Rollup backfill failed", zap.Error(err), zap.Int("rows_written", rows))
+	}
+	observability.Logger.Info("Rollup backfill finished",
+		zap.Time("since", since),
+		zap.Time("until", until),
+		zap.Int("rows_written", rows))
+}
@@ -9,10 +9,19 @@ import (
 	"syscall"
 	"time"
 
+	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/blob"
+	"lystage-proj/internals/budget"
 	"lystage-proj/internals/config"
 	"lystage-proj/internals/db"
+	"lystage-proj/internals/enrich"
+	"lystage-proj/internals/flight"
+	"lystage-proj/internals/fraud"
+	"lystage-proj/internals/lifecycle"
+	"lystage-proj/internals/live"
 	"lystage-proj/internals/observability"
 	"lystage-proj/internals/queue"
+	"lystage-proj/internals/reports"
 	api "lystage-proj/internals/routes"
 	"lystage-proj/internals/worker"
 
@@ -29,8 +38,45 @@ func main() {
 	// Load config
 	cfg := config.Load()
 
+	if cfg.VisitorSalt == "" {
+		observability.Logger.Warn("VISITOR_SALT not set, visitor fingerprints are unsalted")
+	}
+	if cfg.ClickTokenSecret == "" {
+		observability.Logger.Warn("CLICK_TOKEN_SECRET not set, clicks are accepted without signed tokens")
+	}
+
 	// Init DB
 	db.InitPostgres(cfg.DatabaseURL)
+	if cfg.AutoMigrate {
+		db.Migrate()
+	}
+
+	// Init Redis when a shared backend is configured
+	if cfg.RedisAddr != "" {
+		db.InitRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+		defer db.CloseRedis()
+	} else if cfg.AnalyticsCacheBackend == "redis" {
+		observability.Logger.Fatal("ANALYTICS_CACHE_BACKEND=redis requires REDIS_ADDR")
+	} else if cfg.RateLimitBackend == "redis" {
+		observability.Logger.Fatal("RATE_LIMIT_BACKEND=redis requires REDIS_ADDR")
+	} else if cfg.ClickTokenBackend == "redis" {
+		observability.Logger.Fatal("CLICK_TOKEN_BACKEND=redis requires REDIS_ADDR")
+	} else if cfg.FrequencyCapBackend == "redis" {
+		observability.Logger.Fatal("FREQUENCY_CAP_BACKEND=redis requires REDIS_ADDR")
+	}
+	if cfg.FlightClickPolicy != "flag" && cfg.FlightClickPolicy != "reject" {
+		observability.Logger.Fatal("FLIGHT_CLICK_POLICY must be flag or reject", zap.String("policy", cfg.FlightClickPolicy))
+	}
+
+	// Load GeoIP database used to resolve click countries/regions
+	if cfg.GeoIPDBPath != "" {
+		if err := enrich.InitGeoIP(cfg.GeoIPDBPath); err != nil {
+			observability.Logger.Fatal("Failed to open GeoIP database", zap.Error(err))
+		}
+		defer enrich.CloseGeoIP()
+	} else {
+		observability.Logger.Warn("GEOIP_DB_PATH not set, click country/region will be empty")
+	}
 
 	// Init Kafka producer (using the new global producer)
 	if err := queue.InitGlobalProducer(cfg.KafkaBroker, cfg.ClicksTopic); err != nil {
@@ -44,11 +90,60 @@ func main() {
 		}
 	}()
 
+	// Flights that clicks are checked against, by the API and the worker
+	flights := flight.NewChecker(db.GormDB, cfg.AdServingRefreshInterval, cfg.FlightClickGrace)
+
+	// Fraud rules applied to clicks before they are stored
+	fraudOpts := fraud.Options{
+		Threshold:     cfg.FraudScoreThreshold,
+		IPAdPerMinute: cfg.FraudIPAdClicksPerMinute,
+		IPPerMinute:   cfg.FraudIPClicksPerMinute,
+		Flights:       flights,
+	}
+	if cfg.FraudDatacenterRangesPath != "" {
+		ranges, err := fraud.LoadCIDRFile(cfg.FraudDatacenterRangesPath)
+		if err != nil {
+			observability.Logger.Fatal("Failed to load datacenter IP ranges", zap.Error(err))
+		}
+		fraudOpts.DatacenterRanges = ranges
+	}
+
+	// Background loops, stopped on shutdown once the server has drained
+	background := lifecycle.NewGroup()
+
+	// Relay live click deltas across replicas
+	if db.Redis != nil {
+		background.Go(func(ctx context.Context) {
+			live.DefaultHub.UseRedis(ctx, db.Redis)
+		})
+	}
+
+	// Spend of clicks and impressions, and budget enforcement. The ledger
+	// is stopped after the loops that record spend, so its final flush
+	// includes theirs
+	spend := lifecycle.NewGroup()
+	ledger := budget.NewLedger(db.GormDB, cfg.BudgetFlushInterval)
+	spend.Go(ledger.Run)
+
 	// Start Kafka consumer worker
-	worker.StartClickConsumer(cfg.KafkaBroker, cfg.ClicksTopic, "click-consumers")
+	worker.StartClickConsumer(background, cfg.KafkaBroker, cfg.ClicksTopic, "click-consumers", fraud.NewDefaultEngine(fraudOpts), ledger)
+
+	// Services shared by the API and background workers
+	analyticsService := analytics.NewServiceFromConfig(background, cfg)
+	reportStore, err := blob.NewLocalStore(cfg.ReportStoreDir)
+	if err != nil {
+		observability.Logger.Fatal("Failed to open report store", zap.Error(err))
+	}
+	reportService := reports.NewService(analyticsService, reportStore, cfg.ReportMaxQueued)
+
+	// Start report jobs and scheduled report deliveries
+	worker.StartReportWorkers(background, reportService, cfg)
+
+	// Pause and resume ads on their flight schedules
+	worker.StartFlightScheduler(background, cfg)
 
 	// Setup router with all middleware and handlers
-	router := api.SetupRouter(cfg)
+	router := api.SetupRouter(cfg, background, analyticsService, reportService, ledger, flights)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -82,4 +177,12 @@ func main() {
 	} else {
 		observability.Logger.Info("Server exited gracefully")
 	}
+
+	// Stop background loops and let them flush
+	if !background.Stop(cfg.ShutdownTimeout) {
+		observability.Logger.Warn("Background workers did not stop in time")
+	}
+	if !spend.Stop(cfg.ShutdownTimeout) {
+		observability.Logger.Warn("Ad spend was not flushed in time")
+	}
 }
@@ -40,7 +40,7 @@ func (s *AdService) GetPaginatedAds(ctx context.Context, page, limit int) ([]mod
 
 	// Fetch paginated ads
 	if err := s.DB.WithContext(ctx).
-		Select("id", "title", "image_url", "target_url", "status").
+		Select("id", "title", "image_url", "target_url", "status", "campaign_id").
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -50,3 +50,23 @@ func (s *AdService) GetPaginatedAds(ctx context.Context, page, limit int) ([]mod
 
 	return ads, total, nil
 }
+
+// GetAd fetches a single ad. It returns gorm.ErrRecordNotFound if there is
+// no ad with the given id.
+func (s *AdService) GetAd(ctx context.Context, id uint) (*models.Ad, error) {
+	var ad models.Ad
+	if err := s.DB.WithContext(ctx).First(&ad, id).Error; err != nil {
+		return nil, err
+	}
+	return &ad, nil
+}
+
+// GetVariant fetches one of an ad's creative variants. It returns
+// gorm.ErrRecordNotFound if the ad has no such variant.
+func (s *AdService) GetVariant(ctx context.Context, adID, variantID uint) (*models.AdVariant, error) {
+	var variant models.AdVariant
+	if err := s.DB.WithContext(ctx).Where("ad_id = ?", adID).First(&variant, variantID).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
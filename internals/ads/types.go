@@ -1,9 +1,10 @@
 package ads
 
 type AdResponse struct {
-	ID        uint   `json:"id"`
-	Title     string `json:"title"`
-	ImageURL  string `json:"image_url"`
-	TargetURL string `json:"target_url"`
-	Status    string `json:"status"`
+	ID         uint   `json:"id"`
+	Title      string `json:"title"`
+	ImageURL   string `json:"image_url"`
+	TargetURL  string `json:"target_url"`
+	Status     string `json:"status"`
+	CampaignID *uint  `json:"campaign_id,omitempty"`
 }
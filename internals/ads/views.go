@@ -56,11 +56,12 @@ func (h *Handler) GetAdsHandler(c *gin.Context) {
 	resp := make([]AdResponse, len(ads))
 	for i, ad := range ads {
 		resp[i] = AdResponse{
-			ID:        ad.ID,
-			Title:     ad.Title,
-			ImageURL:  ad.ImageURL,
-			TargetURL: ad.TargetURL,
-			Status:    ad.Status,
+			ID:         ad.ID,
+			Title:      ad.Title,
+			ImageURL:   ad.ImageURL,
+			TargetURL:  ad.TargetURL,
+			Status:     ad.Status,
+			CampaignID: ad.CampaignID,
 		}
 	}
 
@@ -74,9 +75,10 @@ func (h *Handler) GetAdsHandler(c *gin.Context) {
 	)
 
 	c.JSON(http.StatusOK, gin.H{
-		"page":  page,
-		"limit": limit,
-		"total": total,
-		"data":  resp,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+		"has_more": int64(page*limit) < total,
+		"data":     resp,
 	})
 }
@@ -0,0 +1,176 @@
+package analytics
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"lystage-proj/internals/observability"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheKeyBucket is the granularity explicit time ranges are rounded to in
+// cache keys, so requests for ranges ending now issued close together share
+// an entry.
+const cacheKeyBucket = time.Minute
+
+// historicalAfter is how far in the past a range must end before its
+// results are considered settled and cached with the historical TTL.
+const historicalAfter = time.Hour
+
+// Cache stores analytics pages keyed by cacheKey. Implementations treat
+// backend failures as misses so the database remains the source of truth.
+type Cache interface {
+	Get(ctx context.Context, key string) (*AnalyticsPage, bool)
+	Set(ctx context.Context, key string, page *AnalyticsPage, ttl time.Duration)
+	Stats() map[string]interface{}
+}
+
+// MemoryCache is a size-bounded LRU of analytics pages local to one
+// replica. Each entry carries its own expiry.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key       string
+	page      *AnalyticsPage
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a cache holding at most maxEntries pages.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the page cached under key if present and not expired.
+func (c *MemoryCache) Get(_ context.Context, key string) (*AnalyticsPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		observability.AnalyticsCacheMisses.Inc()
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(el, "expired")
+		observability.AnalyticsCacheMisses.Inc()
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	observability.AnalyticsCacheHits.Inc()
+	return entry.page, true
+}
+
+// Set stores a page under key for ttl, evicting the least recently used
+// entries beyond capacity.
+func (c *MemoryCache) Set(_ context.Context, key string, page *AnalyticsPage, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.page = page
+		entry.expiresAt = expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, page: page, expiresAt: expiresAt})
+	observability.AnalyticsCacheEntries.Set(float64(c.ll.Len()))
+
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back(), "capacity")
+	}
+}
+
+// removeElement drops an entry; callers must hold c.mu.
+func (c *MemoryCache) removeElement(el *list.Element, reason string) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).key)
+	observability.AnalyticsCacheEvictions.WithLabelValues(reason).Inc()
+	observability.AnalyticsCacheEntries.Set(float64(c.ll.Len()))
+}
+
+// Stats returns cache statistics for monitoring.
+func (c *MemoryCache) Stats() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expired := 0
+	now := time.Now()
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		if now.After(el.Value.(*cacheEntry).expiresAt) {
+			expired++
+		}
+	}
+
+	return map[string]interface{}{
+		"backend":         "memory",
+		"total_entries":   c.ll.Len(),
+		"valid_entries":   c.ll.Len() - expired,
+		"expired_entries": expired,
+		"max_entries":     c.maxEntries,
+	}
+}
+
+// isCacheable reports whether pages for filters are served from the cache,
+// and so worth storing: real-time requests and settled historical ranges.
+func isCacheable(filters AnalyticsFilters) bool {
+	return filters.RealTime || isHistorical(filters)
+}
+
+// isHistorical reports whether the filter's range ended long enough ago
+// that its results are settled.
+func isHistorical(filters AnalyticsFilters) bool {
+	return !filters.Until.IsZero() && time.Since(filters.Until) > historicalAfter
+}
+
+// cacheKey normalizes every filter that affects the page into a string.
+// Rolling windows are keyed by their length, so an entry outlives the
+// minute it was loaded in and is served stale while it is revalidated;
+// other range bounds are rounded to cacheKeyBucket.
+func cacheKey(filters AnalyticsFilters) string {
+	dims := make([]string, 0)
+	for _, df := range filters.dimensionFilters() {
+		dims = append(dims, df.Column+"="+df.Value)
+	}
+
+	bucket := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Truncate(cacheKeyBucket).Unix()
+	}
+
+	timeRange := fmt.Sprintf("since=%d|until=%d", bucket(filters.Since), bucket(filters.Until))
+	if filters.rolling {
+		timeRange = fmt.Sprintf("window=%s", filters.TimeWindow)
+	}
+
+	// Relative comparison ranges follow the current range
+	var compareSince, compareUntil int64
+	if filters.Compare == CompareCustom {
+		compareSince, compareUntil = bucket(filters.CompareSince), bucket(filters.CompareUntil)
+	}
+
+	return fmt.Sprintf("ad=%d|campaign=%d|advertiser=%d|rollup=%s|%s|cmp=%s,%d,%d|group=%s|dims=%s|id=%s|approx=%t|ctr=%t|dist=%t|fraud=%t|sort=%s,%t|page=%d,%d",
+		filters.AdID, filters.CampaignID, filters.AdvertiserID, filters.RollUp, timeRange,
+		filters.Compare, compareSince, compareUntil,
+		strings.Join(filters.GroupBy, ","), strings.Join(dims, ","),
+		filters.Identity, filters.Approximate, filters.IncludeCTR, filters.IncludeDistribution,
+		filters.IncludeFraud, filters.Sort, filters.SortAsc, filters.Offset, filters.Limit)
+}
@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const cursorVersion = 1
+
+// Sort fields accepted by the sort parameter.
+const (
+	SortClickCount      = "click_count"
+	SortUniqueClicks    = "unique_clicks"
+	SortCTR             = "ctr"
+	SortAvgWatchPercent = "avg_watch_percent"
+	SortLastUpdated     = "last_updated"
+)
+
+// sortFields are the sortable result columns; each is a select alias in
+// buildAnalyticsQuery.
+var sortFields = map[string]bool{
+	SortClickCount:      true,
+	SortUniqueClicks:    true,
+	SortCTR:             true,
+	SortAvgWatchPercent: true,
+	SortLastUpdated:     true,
+}
+
+var (
+	errInvalidFilters = errors.New("invalid filters")
+	errInvalidCursor  = errors.New("invalid cursor")
+)
+
+// cursorState is the decoded form of an opaque page cursor. It freezes the
+// resolved time range so that later pages cover the same snapshot even as
+// new clicks arrive or a relative time_window moves on.
+type cursorState struct {
+	Version int       `json:"v"`
+	Offset  int       `json:"o"`
+	Since   time.Time `json:"s"`
+	Until   time.Time `json:"u"`
+	Query   string    `json:"q"` // queryHash of the filters the cursor was issued for
+}
+
+func encodeCursor(state cursorState) string {
+	state.Version = cursorVersion
+	data, _ := json.Marshal(state)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursorState, error) {
+	var state cursorState
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return state, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &state); err != nil || state.Version != cursorVersion || state.Offset < 0 {
+		return state, errInvalidCursor
+	}
+	return state, nil
+}
+
+// queryHash fingerprints everything that determines the ordered result set
+// apart from the time range and page position, so a cursor cannot be
+// replayed against a different query.
+func (f AnalyticsFilters) queryHash() string {
+	dims := make([]string, 0)
+	for _, df := range f.dimensionFilters() {
+		dims = append(dims, df.Column+"="+df.Value)
+	}
+	// Relative comparison ranges follow the frozen range; explicit ones
+	// are part of the query
+	compare := f.Compare
+	if f.Compare == CompareCustom {
+		compare += fmt.Sprintf(",%d,%d", f.CompareSince.UnixNano(), f.CompareUntil.UnixNano())
+	}
+	key := fmt.Sprintf("%d|%d|%d|%s|%s|%s|%s|%t|%t|%s|%t|%s",
+		f.AdID, f.CampaignID, f.AdvertiserID, f.RollUp, strings.Join(f.GroupBy, ","), strings.Join(dims, ","),
+		f.Identity, f.Approximate, f.IncludeFraud, f.Sort, f.SortAsc, compare)
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// orderClause returns the ORDER BY for the filter's sort, with the group
+// columns as tie-breakers so pages are deterministic.
+func orderClause(filters AnalyticsFilters) string {
+	direction := "DESC"
+	if filters.SortAsc {
+		direction = "ASC"
+	}
+
+	clauses := []string{filters.Sort + " " + direction}
+	for _, column := range groupColumns(filters) {
+		clauses = append(clauses, column+" ASC")
+	}
+	return strings.Join(clauses, ", ")
+}
@@ -0,0 +1,234 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"lystage-proj/internals/sketch"
+	"strings"
+	"time"
+)
+
+// distribution accumulates the playback histogram and watch quartiles for
+// one result row.
+type distribution struct {
+	playback  *sketch.Histogram
+	quartiles WatchQuartiles
+}
+
+func newDistribution() *distribution {
+	return &distribution{playback: sketch.NewHistogram(sketch.PlaybackBuckets)}
+}
+
+// apply writes percentiles and quartiles onto a result.
+func (d *distribution) apply(result *AdAnalytics) {
+	result.PlaybackP50 = d.playback.Quantile(0.50)
+	result.PlaybackP90 = d.playback.Quantile(0.90)
+	result.PlaybackP99 = d.playback.Quantile(0.99)
+	quartiles := d.quartiles
+	result.WatchQuartiles = &quartiles
+}
+
+// addDistributions fills playback percentiles and watch quartiles for each
+// result. Playback times are bucketed into sketch.PlaybackBuckets, so
+// percentiles are interpolated within a bucket. Approximate requests merge
+// the hourly rollup histograms; exact requests bucket raw clicks.
+func (s *Service) addDistributions(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	var (
+		dists map[string]*distribution
+		err   error
+	)
+	if filters.Approximate {
+		dists, err = s.rollupDistributions(ctx, filters, results)
+	} else {
+		dists, err = s.clickDistributions(ctx, filters, results)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range results {
+		d, ok := dists[resultGroupKey(filters, results[i])]
+		if !ok {
+			d = newDistribution()
+		}
+		d.apply(&results[i])
+	}
+	return nil
+}
+
+// clickDistributions buckets raw clicks per result group in a single query.
+func (s *Service) clickDistributions(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) (map[string]*distribution, error) {
+	bounds := make([]string, len(sketch.PlaybackBuckets))
+	for i, b := range sketch.PlaybackBuckets {
+		bounds[i] = fmt.Sprint(b)
+	}
+
+	columns := groupColumns(filters)
+	groupBy := strings.Join(columns, ", ")
+
+	query := s.clicksTable(s.DB.WithContext(ctx), filters).
+		Select(groupBy+`,
+			GREATEST(width_bucket(COALESCE(playback_time_sec, 0), ARRAY[`+strings.Join(bounds, ",")+`]::float8[]) - 1, 0) as bucket,
+			COUNT(*) as clicks,
+			COUNT(*) FILTER (WHERE watched_percent >= 25) as reached25,
+			COUNT(*) FILTER (WHERE watched_percent >= 50) as reached50,
+			COUNT(*) FILTER (WHERE watched_percent >= 75) as reached75,
+			COUNT(*) FILTER (WHERE watched_percent >= 100) as reached100
+		`).
+		Where(columns[0]+" IN ?", resultGroupIDs(filters, results)).
+		Group(groupBy + ", bucket")
+
+	rows, err := applyClickFilters(query, filters).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dists := make(map[string]*distribution)
+	for rows.Next() {
+		var (
+			groupID    int
+			dims       = make([]sql.NullString, len(columns)-1)
+			bucket     int
+			clicks     int64
+			quartiles  WatchQuartiles
+			scanTarget = []interface{}{&groupID}
+		)
+		for i := range dims {
+			scanTarget = append(scanTarget, &dims[i])
+		}
+		scanTarget = append(scanTarget, &bucket, &clicks,
+			&quartiles.Reached25, &quartiles.Reached50, &quartiles.Reached75, &quartiles.Reached100)
+
+		if err := rows.Scan(scanTarget...); err != nil {
+			return nil, err
+		}
+
+		parts := []string{fmt.Sprint(groupID)}
+		for _, d := range dims {
+			parts = append(parts, d.String)
+		}
+		key := strings.Join(parts, "\x00")
+
+		d, ok := dists[key]
+		if !ok {
+			d = newDistribution()
+			dists[key] = d
+		}
+		d.playback.AddCount(bucket, clicks)
+		d.quartiles.Reached25 += quartiles.Reached25
+		d.quartiles.Reached50 += quartiles.Reached50
+		d.quartiles.Reached75 += quartiles.Reached75
+		d.quartiles.Reached100 += quartiles.Reached100
+	}
+	return dists, rows.Err()
+}
+
+// rollupDistributions merges hourly rollup histograms per ad. Rollups are
+// only kept per ad, so this is never used for dimensional queries.
+func (s *Service) rollupDistributions(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) (map[string]*distribution, error) {
+	query := s.DB.WithContext(ctx).
+		Table("click_rollups").
+		Select("ad_id, playback_histogram, watched25, watched50, watched75, watched100").
+		Where("ad_id IN ?", resultAdIDs(results)).
+		Where("playback_histogram IS NOT NULL")
+
+	if !filters.Since.IsZero() {
+		query = query.Where("bucket_start >= ?", filters.Since.UTC().Truncate(time.Hour))
+	}
+	if !filters.Until.IsZero() {
+		query = query.Where("bucket_start <= ?", filters.Until)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dists := make(map[string]*distribution)
+	for rows.Next() {
+		var (
+			adID      int
+			data      []byte
+			quartiles WatchQuartiles
+		)
+		if err := rows.Scan(&adID, &data,
+			&quartiles.Reached25, &quartiles.Reached50, &quartiles.Reached75, &quartiles.Reached100); err != nil {
+			return nil, err
+		}
+
+		hist := sketch.NewHistogram(sketch.PlaybackBuckets)
+		if err := hist.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprint(adID)
+		d, ok := dists[key]
+		if !ok {
+			d = newDistribution()
+			dists[key] = d
+		}
+		if err := d.playback.Merge(hist); err != nil {
+			return nil, err
+		}
+		d.quartiles.Reached25 += quartiles.Reached25
+		d.quartiles.Reached50 += quartiles.Reached50
+		d.quartiles.Reached75 += quartiles.Reached75
+		d.quartiles.Reached100 += quartiles.Reached100
+	}
+	return dists, rows.Err()
+}
+
+// resultGroupKey identifies a result row by its group columns, matching the
+// keys built from scanned distribution rows.
+func resultGroupKey(filters AnalyticsFilters, result AdAnalytics) string {
+	parts := []string{fmt.Sprint(resultGroupID(filters, result))}
+	for _, dimension := range filters.GroupBy {
+		switch dimension {
+		case "device":
+			parts = append(parts, result.DeviceType)
+		case "browser":
+			parts = append(parts, result.Browser)
+		case "os":
+			parts = append(parts, result.OS)
+		case "country":
+			parts = append(parts, result.Country)
+		case "region":
+			parts = append(parts, result.Region)
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// resultGroupID returns the value of a result row's leadColumn.
+func resultGroupID(filters AnalyticsFilters, result AdAnalytics) int {
+	switch filters.RollUp {
+	case RollUpCampaign:
+		return result.CampaignID
+	case RollUpAdvertiser:
+		return result.AdvertiserID
+	}
+	return result.AdID
+}
+
+func resultGroupIDs(filters AnalyticsFilters, results []AdAnalytics) []int {
+	ids := make([]int, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, resultGroupID(filters, result))
+	}
+	return ids
+}
+
+func resultAdIDs(results []AdAnalytics) []int {
+	adIDs := make([]int, 0, len(results))
+	for _, result := range results {
+		adIDs = append(adIDs, result.AdID)
+	}
+	return adIDs
+}
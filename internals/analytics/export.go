@@ -0,0 +1,426 @@
+package analytics
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lystage-proj/internals/models"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Export formats accepted by the format parameter.
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+var exportContentTypes = map[string]string{
+	FormatCSV:     "text/csv; charset=utf-8",
+	FormatNDJSON:  "application/x-ndjson",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+const (
+	// exportBatchSize is how many rows are read from the database cursor
+	// and enriched before being written out.
+	exportBatchSize = 1000
+	// parquetRowGroupSize bounds the rows the parquet writer buffers
+	// before flushing a row group.
+	parquetRowGroupSize = 50000
+)
+
+// AnalyticsExportRow is one analytics result as written to exports. It is
+// flat so that it maps directly onto CSV columns and a parquet schema.
+type AnalyticsExportRow struct {
+	AdID             int       `json:"ad_id,omitempty" parquet:"ad_id,optional"`
+	CampaignID       int       `json:"campaign_id,omitempty" parquet:"campaign_id,optional"`
+	AdvertiserID     int       `json:"advertiser_id,omitempty" parquet:"advertiser_id,optional"`
+	DeviceType       string    `json:"device_type,omitempty" parquet:"device_type,optional"`
+	Browser          string    `json:"browser,omitempty" parquet:"browser,optional"`
+	OS               string    `json:"os,omitempty" parquet:"os,optional"`
+	Country          string    `json:"country,omitempty" parquet:"country,optional"`
+	Region           string    `json:"region,omitempty" parquet:"region,optional"`
+	ClickCount       int64     `json:"click_count" parquet:"click_count"`
+	UniqueClicks     int64     `json:"unique_clicks" parquet:"unique_clicks"`
+	UniqueError      float64   `json:"unique_clicks_error,omitempty" parquet:"unique_clicks_error,optional"`
+	AvgPlaybackTime  float64   `json:"avg_playback_time" parquet:"avg_playback_time"`
+	AvgWatchPercent  float64   `json:"avg_watch_percent" parquet:"avg_watch_percent"`
+	PlaybackP50      float64   `json:"playback_p50,omitempty" parquet:"playback_p50,optional"`
+	PlaybackP90      float64   `json:"playback_p90,omitempty" parquet:"playback_p90,optional"`
+	PlaybackP99      float64   `json:"playback_p99,omitempty" parquet:"playback_p99,optional"`
+	Reached25        int64     `json:"reached_25,omitempty" parquet:"reached_25,optional"`
+	Reached50        int64     `json:"reached_50,omitempty" parquet:"reached_50,optional"`
+	Reached75        int64     `json:"reached_75,omitempty" parquet:"reached_75,optional"`
+	Reached100       int64     `json:"reached_100,omitempty" parquet:"reached_100,optional"`
+	CTR              float64   `json:"ctr,omitempty" parquet:"ctr,optional"`
+	Impressions      int64     `json:"impressions,omitempty" parquet:"impressions,optional"`
+	FraudulentClicks int64     `json:"fraudulent_clicks" parquet:"fraudulent_clicks"`
+	CappedRequests   int64     `json:"capped_requests" parquet:"capped_requests"`
+	LastUpdated      time.Time `json:"last_updated" parquet:"last_updated,timestamp(millisecond)"`
+}
+
+var analyticsExportHeader = []string{
+	"ad_id", "campaign_id", "advertiser_id", "device_type", "browser", "os", "country", "region",
+	"click_count", "unique_clicks", "unique_clicks_error",
+	"avg_playback_time", "avg_watch_percent",
+	"playback_p50", "playback_p90", "playback_p99",
+	"reached_25", "reached_50", "reached_75", "reached_100",
+	"ctr", "impressions", "fraudulent_clicks", "capped_requests", "last_updated",
+}
+
+func newAnalyticsExportRow(result AdAnalytics) AnalyticsExportRow {
+	row := AnalyticsExportRow{
+		AdID:             result.AdID,
+		CampaignID:       result.CampaignID,
+		AdvertiserID:     result.AdvertiserID,
+		DeviceType:       result.DeviceType,
+		Browser:          result.Browser,
+		OS:               result.OS,
+		Country:          result.Country,
+		Region:           result.Region,
+		ClickCount:       result.ClickCount,
+		UniqueClicks:     result.UniqueClicks,
+		UniqueError:      result.UniqueError,
+		AvgPlaybackTime:  result.AvgPlaybackTime,
+		AvgWatchPercent:  result.AvgWatchPercent,
+		PlaybackP50:      result.PlaybackP50,
+		PlaybackP90:      result.PlaybackP90,
+		PlaybackP99:      result.PlaybackP99,
+		CTR:              result.CTR,
+		Impressions:      result.Impressions,
+		FraudulentClicks: result.FraudulentClicks,
+		CappedRequests:   result.CappedRequests,
+		LastUpdated:      result.LastUpdated,
+	}
+	if q := result.WatchQuartiles; q != nil {
+		row.Reached25, row.Reached50, row.Reached75, row.Reached100 = q.Reached25, q.Reached50, q.Reached75, q.Reached100
+	}
+	return row
+}
+
+func (r AnalyticsExportRow) csvRecord() []string {
+	return []string{
+		formatID(r.AdID), formatID(r.CampaignID), formatID(r.AdvertiserID), r.DeviceType, r.Browser, r.OS, r.Country, r.Region,
+		formatInt(r.ClickCount), formatInt(r.UniqueClicks), formatFloat(r.UniqueError),
+		formatFloat(r.AvgPlaybackTime), formatFloat(r.AvgWatchPercent),
+		formatFloat(r.PlaybackP50), formatFloat(r.PlaybackP90), formatFloat(r.PlaybackP99),
+		formatInt(r.Reached25), formatInt(r.Reached50), formatInt(r.Reached75), formatInt(r.Reached100),
+		formatFloat(r.CTR), formatInt(r.Impressions), formatInt(r.FraudulentClicks), formatInt(r.CappedRequests), r.LastUpdated.UTC().Format(time.RFC3339),
+	}
+}
+
+// ClickExportRow is one raw click as written to exports.
+type ClickExportRow struct {
+	ID              uint      `json:"id" parquet:"id"`
+	EventID         string    `json:"event_id" parquet:"event_id"`
+	AdID            uint      `json:"ad_id" parquet:"ad_id"`
+	ImpressionID    string    `json:"impression_id,omitempty" parquet:"impression_id,optional"`
+	VariantID       uint      `json:"variant_id,omitempty" parquet:"variant_id,optional"`
+	UserIP          string    `json:"user_ip" parquet:"user_ip"`
+	UserAgent       string    `json:"user_agent" parquet:"user_agent"`
+	VisitorID       string    `json:"visitor_id,omitempty" parquet:"visitor_id,optional"`
+	Fingerprint     string    `json:"fingerprint" parquet:"fingerprint"`
+	PlaybackTimeSec float64   `json:"playback_time_sec" parquet:"playback_time_sec"`
+	WatchedPercent  float64   `json:"watched_percent" parquet:"watched_percent"`
+	DeviceType      string    `json:"device_type" parquet:"device_type"`
+	Browser         string    `json:"browser" parquet:"browser"`
+	OS              string    `json:"os" parquet:"os"`
+	Country         string    `json:"country" parquet:"country"`
+	Region          string    `json:"region" parquet:"region"`
+	IsFraudulent    bool      `json:"is_fraudulent" parquet:"is_fraudulent"`
+	FraudScore      float64   `json:"fraud_score" parquet:"fraud_score"`
+	FraudReasons    string    `json:"fraud_reasons,omitempty" parquet:"fraud_reasons,optional"`
+	CreatedAt       time.Time `json:"created_at" parquet:"created_at,timestamp(millisecond)"`
+}
+
+var clickExportHeader = []string{
+	"id", "event_id", "ad_id", "impression_id", "variant_id", "user_ip", "user_agent", "visitor_id", "fingerprint",
+	"playback_time_sec", "watched_percent",
+	"device_type", "browser", "os", "country", "region",
+	"is_fraudulent", "fraud_score", "fraud_reasons", "created_at",
+}
+
+func newClickExportRow(click models.Click) ClickExportRow {
+	row := ClickExportRow{
+		ID:              click.ID,
+		EventID:         click.EventID.String(),
+		AdID:            click.AdID,
+		UserIP:          click.UserIP,
+		UserAgent:       click.UserAgent,
+		VisitorID:       click.VisitorID,
+		Fingerprint:     click.Fingerprint,
+		PlaybackTimeSec: click.PlaybackTimeSec,
+		WatchedPercent:  click.WatchedPercent,
+		DeviceType:      click.DeviceType,
+		Browser:         click.Browser,
+		OS:              click.OS,
+		Country:         click.Country,
+		Region:          click.Region,
+		IsFraudulent:    click.IsFraudulent,
+		FraudScore:      click.FraudScore,
+		FraudReasons:    click.FraudReasons,
+		CreatedAt:       click.CreatedAt,
+	}
+	if click.ImpressionID != nil {
+		row.ImpressionID = click.ImpressionID.String()
+	}
+	if click.VariantID != nil {
+		row.VariantID = *click.VariantID
+	}
+	return row
+}
+
+func (r ClickExportRow) csvRecord() []string {
+	return []string{
+		strconv.FormatUint(uint64(r.ID), 10), r.EventID, strconv.FormatUint(uint64(r.AdID), 10), r.ImpressionID, formatID(int(r.VariantID)),
+		r.UserIP, r.UserAgent, r.VisitorID, r.Fingerprint,
+		formatFloat(r.PlaybackTimeSec), formatFloat(r.WatchedPercent),
+		r.DeviceType, r.Browser, r.OS, r.Country, r.Region,
+		strconv.FormatBool(r.IsFraudulent), formatFloat(r.FraudScore), r.FraudReasons, r.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// formatID leaves the id columns a row is not keyed by empty.
+func formatID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+type exportRow interface {
+	csvRecord() []string
+}
+
+// rowWriter encodes export rows in one format. Close must be called to
+// write any trailer (the parquet footer) and flush buffered rows.
+type rowWriter[T exportRow] interface {
+	Write(rows []T) error
+	Close() error
+}
+
+// ValidExportFormat reports whether format is a supported export format.
+func ValidExportFormat(format string) bool {
+	_, ok := exportContentTypes[format]
+	return ok
+}
+
+// ExportContentType returns the Content-Type for an export format.
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+func newRowWriter[T exportRow](w io.Writer, format string, header []string) (rowWriter[T], error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvRowWriter[T]{w: cw}, nil
+	case FormatNDJSON:
+		return &ndjsonRowWriter[T]{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return &parquetRowWriter[T]{w: parquet.NewGenericWriter[T](w,
+			parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+			parquet.Compression(&parquet.Snappy),
+		)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+type csvRowWriter[T exportRow] struct {
+	w *csv.Writer
+}
+
+func (cw *csvRowWriter[T]) Write(rows []T) error {
+	for _, row := range rows {
+		if err := cw.w.Write(row.csvRecord()); err != nil {
+			return err
+		}
+	}
+	cw.w.Flush() // Hand each batch to the response instead of buffering
+	return cw.w.Error()
+}
+
+func (cw *csvRowWriter[T]) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonRowWriter[T exportRow] struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonRowWriter[T]) Write(rows []T) error {
+	for _, row := range rows {
+		if err := nw.enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (nw *ndjsonRowWriter[T]) Close() error {
+	return nil
+}
+
+type parquetRowWriter[T exportRow] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (pw *parquetRowWriter[T]) Write(rows []T) error {
+	_, err := pw.w.Write(rows)
+	return err
+}
+
+func (pw *parquetRowWriter[T]) Close() error {
+	return pw.w.Close()
+}
+
+// ExportAnalytics streams every analytics row matching filters to w in
+// the given format, ignoring pagination. Rows are read from a database
+// cursor and enriched in batches, so memory use does not grow with the
+// range. flush is called after each batch, e.g. to push it to the client.
+func (s *Service) ExportAnalytics(ctx context.Context, filters AnalyticsFilters, format string, w io.Writer, flush func()) (int64, error) {
+	filters.Cursor = ""
+	if err := s.prepareFilters(&filters); err != nil {
+		return 0, err
+	}
+	// Export rows have no comparison columns
+	if filters.comparing() {
+		return 0, fmt.Errorf("%w: compare is not supported by exports", errInvalidFilters)
+	}
+
+	out, err := newRowWriter[AnalyticsExportRow](w, format, analyticsExportHeader)
+	if err != nil {
+		return 0, err
+	}
+
+	// Limit(-1) and Offset(-1) drop the page bounds set by buildAnalyticsQuery
+	rows, err := s.buildAnalyticsQuery(ctx, filters).Limit(-1).Offset(-1).Rows()
+	if err != nil {
+		return 0, fmt.Errorf("database query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		written int64
+		batch   = make([]AdAnalytics, 0, exportBatchSize)
+	)
+	writeBatch := func() error {
+		if err := s.enrichResults(ctx, filters, batch); err != nil {
+			return err
+		}
+		exportRows := make([]AnalyticsExportRow, len(batch))
+		for i, result := range batch {
+			exportRows[i] = newAnalyticsExportRow(result)
+		}
+		if err := out.Write(exportRows); err != nil {
+			return err
+		}
+		written += int64(len(batch))
+		batch = batch[:0]
+		flush()
+		return nil
+	}
+
+	for rows.Next() {
+		var result AdAnalytics
+		if err := s.DB.ScanRows(rows, &result); err != nil {
+			return written, err
+		}
+		batch = append(batch, result)
+		if len(batch) == exportBatchSize {
+			if err := writeBatch(); err != nil {
+				return written, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return written, err
+	}
+	if len(batch) > 0 {
+		if err := writeBatch(); err != nil {
+			return written, err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return written, err
+	}
+	flush()
+	return written, nil
+}
+
+// ExportClicks streams the raw clicks matching filters' ad, campaign,
+// advertiser, time range and dimension values to w in the given format,
+// oldest first.
+func (s *Service) ExportClicks(ctx context.Context, filters AnalyticsFilters, format string, w io.Writer, flush func()) (int64, error) {
+	filters.Cursor = ""
+	if err := s.prepareFilters(&filters); err != nil {
+		return 0, err
+	}
+
+	out, err := newRowWriter[ClickExportRow](w, format, clickExportHeader)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := applyClickFilters(s.clicksTable(s.DB.WithContext(ctx), filters), filters).
+		Order("created_at ASC, id ASC").
+		Rows()
+	if err != nil {
+		return 0, fmt.Errorf("database query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		written int64
+		batch   = make([]ClickExportRow, 0, exportBatchSize)
+	)
+	for rows.Next() {
+		var click models.Click
+		if err := s.DB.ScanRows(rows, &click); err != nil {
+			return written, err
+		}
+		batch = append(batch, newClickExportRow(click))
+		if len(batch) == exportBatchSize {
+			if err := out.Write(batch); err != nil {
+				return written, err
+			}
+			written += int64(len(batch))
+			batch = batch[:0]
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return written, err
+	}
+
+	if err := out.Write(batch); err != nil {
+		return written, err
+	}
+	written += int64(len(batch))
+
+	if err := out.Close(); err != nil {
+		return written, err
+	}
+	flush()
+	return written, nil
+}
@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// flightGroup deduplicates concurrent loads of the same analytics query:
+// the first caller runs the load and later callers with the same key wait
+// for and share its result.
+//
+// A shared load is not tied to any one caller's context. It keeps the first
+// caller's deadline but is only cancelled once every caller waiting on it
+// has gone away, so one client disconnecting does not fail the others.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	page    *AnalyticsPage
+	err     error
+	waiters int // Callers still interested in the result; guarded by flightGroup.mu
+}
+
+type loadFunc func(ctx context.Context) (*AnalyticsPage, error)
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// Do runs fn once for all concurrent callers with the same key. shared
+// reports whether the result came from another caller's load. If ctx is
+// done before the load finishes, Do returns ctx.Err() and the load is
+// cancelled when no other callers are waiting for it.
+func (g *flightGroup) Do(ctx context.Context, key string, fn loadFunc) (page *AnalyticsPage, err error, shared bool) {
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if shared {
+		call.waiters++
+	} else {
+		call = g.start(ctx, key)
+	}
+	g.mu.Unlock()
+
+	if !shared {
+		go g.finish(key, call, fn)
+	}
+
+	select {
+	case <-call.done:
+		return call.page, call.err, shared
+	case <-ctx.Done():
+		g.leave(call)
+		return nil, ctx.Err(), shared
+	}
+}
+
+// TryGo starts fn in the background unless a load for key is already in
+// flight, and reports whether it started one. The load runs under ctx
+// alone and has no waiters to cancel it.
+func (g *flightGroup) TryGo(ctx context.Context, key string, fn loadFunc) bool {
+	g.mu.Lock()
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+
+	call := g.start(ctx, key)
+	call.waiters = 0
+	g.mu.Unlock()
+
+	go g.finish(key, call, fn)
+	return true
+}
+
+// start registers a new call whose load context keeps ctx's values and
+// deadline but not its cancellation; callers must hold g.mu.
+func (g *flightGroup) start(ctx context.Context, key string) *flightCall {
+	var (
+		base    = context.WithoutCancel(ctx)
+		loadCtx context.Context
+		cancel  context.CancelFunc
+	)
+	if deadline, ok := ctx.Deadline(); ok {
+		loadCtx, cancel = context.WithDeadline(base, deadline)
+	} else {
+		loadCtx, cancel = context.WithCancel(base)
+	}
+
+	call := &flightCall{ctx: loadCtx, cancel: cancel, done: make(chan struct{}), waiters: 1}
+	g.calls[key] = call
+	return call
+}
+
+// leave drops a waiter and cancels the load once nobody is left.
+func (g *flightGroup) leave(call *flightCall) {
+	g.mu.Lock()
+	call.waiters--
+	abandoned := call.waiters == 0
+	g.mu.Unlock()
+
+	if abandoned {
+		call.cancel()
+	}
+}
+
+func (g *flightGroup) finish(key string, call *flightCall, fn loadFunc) {
+	defer func() {
+		// Waiters must never observe a nil page without an error
+		if r := recover(); r != nil {
+			call.page, call.err = nil, fmt.Errorf("analytics load panicked: %v", r)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+		call.cancel()
+	}()
+
+	call.page, call.err = fn(call.ctx)
+}
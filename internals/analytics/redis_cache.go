@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"lystage-proj/internals/observability"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const redisCacheKeyPrefix = "lvstage:analytics:"
+
+// RedisCache stores analytics pages in a Redis-protocol server shared by all
+// replicas. Eviction is left to the server's maxmemory policy; entries
+// expire through their TTL.
+type RedisCache struct {
+	client *redis.Client
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+// redisKey hashes the normalized query to keep keys short.
+func redisKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return redisCacheKeyPrefix + hex.EncodeToString(sum[:16])
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (*AnalyticsPage, bool) {
+	data, err := c.client.Get(ctx, redisKey(key)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			observability.Logger.Warn("Analytics cache read failed", zap.Error(err))
+		}
+		c.misses.Add(1)
+		observability.AnalyticsCacheMisses.Inc()
+		return nil, false
+	}
+
+	var page AnalyticsPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		observability.Logger.Warn("Discarding undecodable analytics cache entry", zap.Error(err))
+		c.misses.Add(1)
+		observability.AnalyticsCacheMisses.Inc()
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	observability.AnalyticsCacheHits.Inc()
+	return &page, true
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, page *AnalyticsPage, ttl time.Duration) {
+	data, err := json.Marshal(page)
+	if err != nil {
+		observability.Logger.Warn("Failed to encode analytics cache entry", zap.Error(err))
+		return
+	}
+
+	if err := c.client.Set(ctx, redisKey(key), data, ttl).Err(); err != nil {
+		observability.Logger.Warn("Analytics cache write failed", zap.Error(err))
+	}
+}
+
+// Stats reports this replica's hit/miss counts; entry counts live on the
+// server.
+func (c *RedisCache) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"backend": "redis",
+		"hits":    c.hits.Load(),
+		"misses":  c.misses.Load(),
+	}
+}
@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/redistest"
+
+	"go.uber.org/zap"
+)
+
+func newTestRedisCache(t *testing.T) (*redistest.Server, *RedisCache) {
+	observability.Logger = zap.NewNop()
+
+	server := redistest.NewServer(t)
+	return server, NewRedisCache(server.NewClient(t))
+}
+
+func TestRedisCacheRoundTrip(t *testing.T) {
+	server, cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	if _, ok := cache.Get(ctx, "q"); ok {
+		t.Fatal("hit on empty cache")
+	}
+
+	freshUntil := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache.Set(ctx, "q", &AnalyticsPage{
+		Data:       []AdAnalytics{{AdID: 7, ClickCount: 42}},
+		FreshUntil: freshUntil,
+	}, time.Minute)
+
+	page, ok := cache.Get(ctx, "q")
+	if !ok {
+		t.Fatal("miss after Set")
+	}
+	if len(page.Data) != 1 || page.Data[0].AdID != 7 || page.Data[0].ClickCount != 42 {
+		t.Fatalf("data = %+v", page.Data)
+	}
+	if !page.FreshUntil.Equal(freshUntil) {
+		t.Fatalf("fresh until = %s, want %s", page.FreshUntil, freshUntil)
+	}
+	if ttl := server.TTL(redisKey("q")); ttl != time.Minute {
+		t.Fatalf("ttl = %s, want %s", ttl, time.Minute)
+	}
+
+	stats := cache.Stats()
+	if stats["hits"] != int64(1) || stats["misses"] != int64(1) {
+		t.Fatalf("stats = %v", stats)
+	}
+}
+
+func TestRedisCacheExpires(t *testing.T) {
+	server, cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	cache.Set(ctx, "q", &AnalyticsPage{}, time.Minute)
+	server.FastForward(time.Minute)
+	if _, ok := cache.Get(ctx, "q"); ok {
+		t.Fatal("hit after expiry")
+	}
+}
+
+func TestRedisCacheKeysAreShared(t *testing.T) {
+	server, cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	// Another replica reads what this one wrote
+	cache.Set(ctx, "q", &AnalyticsPage{Data: []AdAnalytics{{AdID: 3}}}, time.Minute)
+	other := NewRedisCache(server.NewClient(t))
+	if page, ok := other.Get(ctx, "q"); !ok || page.Data[0].AdID != 3 {
+		t.Fatalf("other replica got %+v, %t", page, ok)
+	}
+}
+
+func TestRedisCacheDiscardsUndecodableEntries(t *testing.T) {
+	server, cache := newTestRedisCache(t)
+
+	server.Set(redisKey("q"), "not json")
+	if _, ok := cache.Get(context.Background(), "q"); ok {
+		t.Fatal("hit on undecodable entry")
+	}
+}
+
+func TestRedisCacheMissesWhenUnreachable(t *testing.T) {
+	server, cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	cache.Set(ctx, "q", &AnalyticsPage{}, time.Minute)
+	server.Close()
+	if _, ok := cache.Get(ctx, "q"); ok {
+		t.Fatal("hit without Redis")
+	}
+}
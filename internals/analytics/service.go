@@ -2,39 +2,87 @@ package analytics
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"lystage-proj/internals/config"
 	"lystage-proj/internals/db"
+	"lystage-proj/internals/leader"
+	"lystage-proj/internals/lifecycle"
 	"lystage-proj/internals/observability"
+	"lystage-proj/internals/sketch"
+	"net/url"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+// backgroundLoadTimeout bounds loads not tied to a request: stale-entry
+// revalidation and the periodic cache refresh.
+const backgroundLoadTimeout = 30 * time.Second
+
 type Service struct {
-	DB    *gorm.DB
-	cache *AnalyticsCache
+	DB        *gorm.DB
+	cache     Cache
+	cacheOpts CacheOptions
+	flights   *flightGroup
+	refresher leader.Elector
 }
 
-func NewService() *Service {
-	cache := &AnalyticsCache{
-		metrics: make(map[int]*AdAnalytics),
-		ttl:     2 * time.Minute, // Cache TTL for real-time data
-	}
+// CacheOptions control how long analytics pages are served from cache.
+type CacheOptions struct {
+	TTL           time.Duration // Freshness of ranges ending recently
+	HistoricalTTL time.Duration // Freshness of ranges ending before historicalAfter
+	StaleTTL      time.Duration // How long past freshness a page may still be served while it is revalidated
+}
 
+// NewService creates the analytics service. Only the replica elected by
+// refresher runs the background cache refresh; with a shared cache the
+// others serve what it wrote.
+func NewService(background *lifecycle.Group, cache Cache, cacheOpts CacheOptions, refresher leader.Elector) *Service {
 	service := &Service{
-		DB:    db.GormDB,
-		cache: cache,
+		DB:        db.GormDB,
+		cache:     cache,
+		cacheOpts: cacheOpts,
+		flights:   newFlightGroup(),
+		refresher: refresher,
 	}
 
 	// Start background cache refresh for real-time analytics
-	go service.startCacheRefresh()
+	background.Go(service.startCacheRefresh)
 
 	return service
 }
 
+// NewServiceFromConfig builds the analytics service with the cache backend
+// selected in cfg. It is shared by the API routes and the report scheduler.
+// Its background loops, and the lease of an elected refresher, end with
+// background.
+func NewServiceFromConfig(background *lifecycle.Group, cfg *config.Config) *Service {
+	// A shared cache lets one elected replica refresh it for everyone
+	var (
+		cache     Cache
+		refresher leader.Elector = leader.Always{}
+	)
+	if cfg.AnalyticsCacheBackend == "redis" {
+		cache = NewRedisCache(db.Redis)
+		elector := leader.NewRedisElector(db.Redis, "analytics-cache-refresh", 30*time.Second)
+		background.Go(elector.Run)
+		refresher = elector
+	} else {
+		cache = NewMemoryCache(cfg.AnalyticsCacheSize)
+	}
+
+	return NewService(background, cache, CacheOptions{
+		TTL:           cfg.AnalyticsCacheTTL,
+		HistoricalTTL: cfg.AnalyticsHistoricalCacheTTL,
+		StaleTTL:      cfg.AnalyticsStaleCacheTTL,
+	}, refresher)
+}
+
 // FetchAdAnalytics - Original method for backward compatibility
-func (s *Service) FetchAdAnalytics(adID int, since time.Time, limit, offset int) ([]AdAnalytics, error) {
+func (s *Service) FetchAdAnalytics(ctx context.Context, adID int, since time.Time, limit, offset int) ([]AdAnalytics, error) {
 	filters := AnalyticsFilters{
 		AdID:   adID,
 		Since:  since,
@@ -42,32 +90,164 @@ func (s *Service) FetchAdAnalytics(adID int, since time.Time, limit, offset int)
 		Offset: offset,
 	}
 
-	return s.FetchAdAnalyticsWithFilters(filters)
+	page, err := s.FetchAdAnalyticsWithFilters(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return page.Data, nil
 }
 
-// FetchAdAnalyticsWithFilters - Enhanced method for GET /ads/analytics endpoint
-func (s *Service) FetchAdAnalyticsWithFilters(filters AnalyticsFilters) ([]AdAnalytics, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
+// FetchAdAnalyticsWithFilters - Enhanced method for GET /ads/analytics endpoint.
+// The aggregation honors ctx's cancellation and deadline.
+func (s *Service) FetchAdAnalyticsWithFilters(ctx context.Context, filters AnalyticsFilters) (*AnalyticsPage, error) {
 	// Validate and set defaults
-	if err := s.validateAndSetDefaults(&filters); err != nil {
-		return nil, fmt.Errorf("invalid filters: %w", err)
+	if err := s.prepareFilters(&filters); err != nil {
+		return nil, err
 	}
 
-	// Try cache first for real-time requests
-	if filters.RealTime {
-		if cached := s.getCachedAnalytics(filters); cached != nil {
+	// Try cache first for real-time requests and for settled historical
+	// ranges; entries are keyed by the full normalized query
+	key := cacheKey(filters)
+	if isCacheable(filters) {
+		if cached, ok := s.cache.Get(ctx, key); ok {
+			// Stale pages are still served while one refresh runs
+			if time.Now().After(cached.FreshUntil) {
+				s.revalidate(ctx, key, filters)
+			}
 			observability.Logger.Debug("Serving analytics from cache",
 				zap.Int("ad_id", filters.AdID),
-				zap.Int("results", len(cached)))
+				zap.Int("results", len(cached.Data)))
 			return cached, nil
 		}
 		observability.Logger.Debug("Cache miss, falling back to database")
 	}
 
-	// Fetch from database
-	return s.fetchFromDatabase(ctx, filters)
+	// Fetch from database, sharing the load with identical in-flight queries
+	page, err, shared := s.flights.Do(ctx, key, func(ctx context.Context) (*AnalyticsPage, error) {
+		return s.loadAndCache(ctx, key, filters)
+	})
+	if shared {
+		observability.AnalyticsCoalescedRequests.Inc()
+	}
+	return page, err
+}
+
+// loadAndCache fetches a page from the database and, if the query is served
+// from the cache, caches it until it goes stale.
+func (s *Service) loadAndCache(ctx context.Context, key string, filters AnalyticsFilters) (*AnalyticsPage, error) {
+	page, err := s.fetchFromDatabase(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	if !isCacheable(filters) {
+		return page, nil
+	}
+
+	ttl := s.cacheTTLFor(filters)
+	page.FreshUntil = time.Now().Add(ttl)
+	s.cache.Set(ctx, key, page, ttl+s.cacheOpts.StaleTTL)
+	return page, nil
+}
+
+// revalidate refreshes a stale cache entry in the background unless a load
+// for the same query is already running. The refresh outlives the request
+// that triggered it, so it only inherits ctx's values.
+func (s *Service) revalidate(ctx context.Context, key string, filters AnalyticsFilters) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backgroundLoadTimeout)
+	started := s.flights.TryGo(ctx, key, func(ctx context.Context) (*AnalyticsPage, error) {
+		defer cancel()
+
+		page, err := s.loadAndCache(ctx, key, filters)
+		if err != nil {
+			observability.Logger.Warn("Failed to revalidate stale analytics", zap.Error(err))
+		}
+		return page, err
+	})
+	if !started {
+		cancel()
+		return
+	}
+	observability.AnalyticsStaleRevalidations.Inc()
+}
+
+// cacheTTLFor returns how long results for the filter's range stay fresh.
+// Ranges that ended a while ago no longer change and are kept longer.
+func (s *Service) cacheTTLFor(filters AnalyticsFilters) time.Duration {
+	if isHistorical(filters) {
+		return s.cacheOpts.HistoricalTTL
+	}
+	return s.cacheOpts.TTL
+}
+
+// ValidateFilters reports whether filters would be accepted by the fetch
+// and export methods, without running a query.
+func (s *Service) ValidateFilters(filters AnalyticsFilters) error {
+	return s.prepareFilters(&filters)
+}
+
+// prepareFilters validates filters and resolves the time range, either from
+// a cursor or by freezing it at the current time so the page's next cursor
+// is stable.
+func (s *Service) prepareFilters(filters *AnalyticsFilters) error {
+	filters.rolling = filters.TimeWindow > 0 && filters.Since.IsZero() && filters.Until.IsZero() && filters.Cursor == ""
+	if err := s.validateAndSetDefaults(filters); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidFilters, err)
+	}
+
+	if filters.Cursor != "" {
+		state, err := decodeCursor(filters.Cursor)
+		if err != nil || state.Query != filters.queryHash() {
+			return fmt.Errorf("%w: %w", errInvalidFilters, errInvalidCursor)
+		}
+		filters.Offset = state.Offset
+		filters.Since = state.Since
+		filters.Until = state.Until
+	} else if filters.Until.IsZero() {
+		filters.Until = time.Now()
+	}
+
+	if err := resolveComparison(filters); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidFilters, err)
+	}
+	return nil
+}
+
+// resolveComparison sets the comparison range for relative modes once the
+// current range is known, and checks explicit ranges.
+func resolveComparison(filters *AnalyticsFilters) error {
+	switch filters.Compare {
+	case "":
+		return nil
+	case ComparePreviousPeriod:
+		if filters.Since.IsZero() {
+			return fmt.Errorf("compare=%s requires a since or time_window", filters.Compare)
+		}
+		length := filters.Until.Sub(filters.Since)
+		filters.CompareSince = filters.Since.Add(-length)
+		filters.CompareUntil = filters.Since
+	case ComparePreviousYear:
+		if filters.Since.IsZero() {
+			return fmt.Errorf("compare=%s requires a since or time_window", filters.Compare)
+		}
+		filters.CompareSince = filters.Since.AddDate(-1, 0, 0)
+		filters.CompareUntil = filters.Until.AddDate(-1, 0, 0)
+		if !filters.CompareUntil.Before(filters.Since) {
+			return fmt.Errorf("compare=%s needs a range shorter than a year", filters.Compare)
+		}
+	case CompareCustom:
+		if filters.CompareSince.IsZero() || filters.CompareUntil.IsZero() {
+			return fmt.Errorf("compare_since and compare_until are both required")
+		}
+		if filters.CompareUntil.Before(filters.CompareSince) {
+			return fmt.Errorf("compare_until cannot be before compare_since")
+		}
+		if !filters.CompareUntil.Before(filters.Since) && !filters.CompareSince.After(filters.Until) {
+			return fmt.Errorf("comparison range cannot overlap the current range")
+		}
+	default:
+		return fmt.Errorf("unsupported compare %q", filters.Compare)
+	}
+	return nil
 }
 
 // validateAndSetDefaults ensures filters are valid and sets reasonable defaults
@@ -98,58 +278,71 @@ func (s *Service) validateAndSetDefaults(filters *AnalyticsFilters) error {
 		return fmt.Errorf("until time cannot be before since time")
 	}
 
-	return nil
-}
+	// Validate identity strategy, it is interpolated into the query
+	if filters.Identity == "" {
+		filters.Identity = IdentityIP
+	}
+	if _, ok := uniqueIdentityExprs[filters.Identity]; !ok {
+		return fmt.Errorf("unsupported identity %q", filters.Identity)
+	}
 
-// getCachedAnalytics retrieves analytics from in-memory cache
-func (s *Service) getCachedAnalytics(filters AnalyticsFilters) []AdAnalytics {
-	s.cache.mu.RLock()
-	defer s.cache.mu.RUnlock()
+	// Rollups are per ad, not broken down by dimension and never include
+	// flagged clicks; comparisons count both periods in one exact pass
+	if filters.Approximate && (filters.hasDimensions() || filters.rolledUp() || filters.comparing() || filters.IncludeFraud) {
+		return fmt.Errorf("exact=false cannot be combined with group_by, dimension filters, roll_up, compare or include_fraud")
+	}
 
-	var results []AdAnalytics
-	now := time.Now()
+	// Validate sort, it is interpolated into the query
+	if filters.Sort == "" {
+		filters.Sort = SortClickCount
+	}
+	if !sortFields[filters.Sort] {
+		return fmt.Errorf("unsupported sort field %q", filters.Sort)
+	}
+	if filters.Sort == SortUniqueClicks && filters.Approximate {
+		return fmt.Errorf("sort=unique_clicks requires exact=true")
+	}
 
-	if filters.AdID != 0 {
-		// Single ad request
-		if cached, exists := s.cache.metrics[filters.AdID]; exists {
-			if now.Sub(cached.LastUpdated) < s.cache.ttl {
-				results = append(results, *cached)
-			}
-		}
-	} else {
-		// Multiple ads request - get all valid cached entries
-		for _, cached := range s.cache.metrics {
-			if now.Sub(cached.LastUpdated) < s.cache.ttl {
-				results = append(results, *cached)
-			}
+	// Validate rollup level, its column is interpolated into the query
+	if filters.RollUp != "" {
+		if _, ok := rollUpColumns[filters.RollUp]; !ok {
+			return fmt.Errorf("unsupported roll_up %q", filters.RollUp)
 		}
 	}
 
-	if len(results) == 0 {
-		return nil // Cache miss
+	// Validate dimensions, they are interpolated into the query
+	for _, dimension := range filters.GroupBy {
+		if _, ok := analyticsDimensions[dimension]; !ok {
+			return fmt.Errorf("unsupported group_by dimension %q", dimension)
+		}
 	}
 
-	// Apply pagination to cached results
-	return s.applyPagination(results, filters.Offset, filters.Limit)
+	return nil
 }
 
-// applyPagination applies offset and limit to results
-func (s *Service) applyPagination(results []AdAnalytics, offset, limit int) []AdAnalytics {
-	start := offset
-	end := start + limit
-
-	if start >= len(results) {
-		return []AdAnalytics{}
+// buildPage trims a result set fetched with one extra row to the page
+// limit and issues a cursor for the next page if that row exists.
+func (s *Service) buildPage(results []AdAnalytics, filters AnalyticsFilters) *AnalyticsPage {
+	page := &AnalyticsPage{
+		Data:   results,
+		Limit:  filters.Limit,
+		Offset: filters.Offset,
 	}
-	if end > len(results) {
-		end = len(results)
+	if len(results) > filters.Limit {
+		page.Data = results[:filters.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(cursorState{
+			Offset: filters.Offset + filters.Limit,
+			Since:  filters.Since,
+			Until:  filters.Until,
+			Query:  filters.queryHash(),
+		})
 	}
-
-	return results[start:end]
+	return page
 }
 
 // fetchFromDatabase queries the database for analytics data
-func (s *Service) fetchFromDatabase(ctx context.Context, filters AnalyticsFilters) ([]AdAnalytics, error) {
+func (s *Service) fetchFromDatabase(ctx context.Context, filters AnalyticsFilters) (*AnalyticsPage, error) {
 	var results []AdAnalytics
 
 	// Build optimized query for clicks table
@@ -163,43 +356,252 @@ func (s *Service) fetchFromDatabase(ctx context.Context, filters AnalyticsFilter
 		return nil, fmt.Errorf("database query failed: %w", err)
 	}
 
-	// Add CTR calculation if requested
-	if filters.IncludeCTR {
-		s.addCTRToResults(ctx, results)
+	page := s.buildPage(results, filters)
+	results = page.Data
+
+	if filters.comparing() {
+		page.Comparison = &TimeRange{Since: filters.CompareSince, Until: filters.CompareUntil}
+		for i := range results {
+			results[i].applyComparison()
+		}
 	}
 
-	// Update cache asynchronously for future requests
-	go s.updateCache(results)
+	// Count all matching rows; the first page can skip the query when it
+	// already holds everything
+	if filters.Offset == 0 && !page.HasMore {
+		page.Total = int64(len(results))
+	} else if err := s.countAnalyticsRows(ctx, filters, &page.Total); err != nil {
+		observability.Logger.Error("Failed to count analytics rows",
+			zap.Error(err),
+			zap.Int("ad_id", filters.AdID))
+		return nil, fmt.Errorf("count query failed: %w", err)
+	}
+
+	if err := s.enrichResults(ctx, filters, results); err != nil {
+		return nil, err
+	}
 
 	observability.Logger.Debug("Analytics fetched from database",
 		zap.Int("results", len(results)),
 		zap.Int("ad_id", filters.AdID))
 
-	return results, nil
+	return page, nil
+}
+
+// enrichResults fills in the per-row figures that are computed outside the
+// main aggregation: sketch estimates, distributions, fraud and frequency
+// cap counts and CTR.
+func (s *Service) enrichResults(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) error {
+	// Estimate unique clicks from sketches if requested
+	if filters.Approximate {
+		if err := s.addSketchUniques(ctx, filters, results); err != nil {
+			observability.Logger.Error("Failed to estimate unique clicks from rollups",
+				zap.Error(err),
+				zap.Int("ad_id", filters.AdID))
+			return fmt.Errorf("rollup query failed: %w", err)
+		}
+	}
+
+	// Add playback percentiles and watch quartiles if requested
+	if filters.IncludeDistribution {
+		if err := s.addDistributions(ctx, filters, results); err != nil {
+			observability.Logger.Error("Failed to compute analytics distributions",
+				zap.Error(err),
+				zap.Int("ad_id", filters.AdID))
+			return fmt.Errorf("distribution query failed: %w", err)
+		}
+	}
+
+	// Count the flagged clicks each row leaves out
+	if err := s.addFraudulentClicks(ctx, filters, results); err != nil {
+		observability.Logger.Error("Failed to count fraudulent clicks",
+			zap.Error(err),
+			zap.Int("ad_id", filters.AdID))
+		return fmt.Errorf("fraud count query failed: %w", err)
+	}
+
+	// Serving rollups are per ad, so breakdowns and campaign or advertiser
+	// rollups leave capped requests out
+	if !filters.hasDimensions() && !filters.rolledUp() {
+		if err := s.addCappedRequests(ctx, filters, results); err != nil {
+			observability.Logger.Error("Failed to count frequency capped requests",
+				zap.Error(err),
+				zap.Int("ad_id", filters.AdID))
+			return fmt.Errorf("serving rollup query failed: %w", err)
+		}
+	}
+
+	// Add CTR calculation if requested; sorting by CTR computes it in SQL.
+	// Comparisons always count impressions, per period
+	if filters.comparing() {
+		if err := s.addComparisonImpressions(ctx, filters, results); err != nil {
+			observability.Logger.Error("Failed to count impressions for comparison",
+				zap.Error(err),
+				zap.Int("ad_id", filters.AdID))
+			return fmt.Errorf("impression count query failed: %w", err)
+		}
+	} else if filters.IncludeCTR && filters.Sort != SortCTR {
+		s.addCTRToResults(ctx, filters, results)
+	}
+
+	return nil
 }
 
 // buildAnalyticsQuery constructs the optimized SQL query
 func (s *Service) buildAnalyticsQuery(ctx context.Context, filters AnalyticsFilters) *gorm.DB {
-	query := s.DB.WithContext(ctx).
-		Table("clicks").
-		Select(`
-			ad_id,
-			COUNT(*) as click_count,
-			COUNT(DISTINCT user_ip) as unique_clicks,
-			AVG(playback_time_sec) as avg_playback_time,
-			AVG(watched_percent) as avg_watch_percent,
-			MAX(created_at) as last_updated
-		`).
-		Group("ad_id").
-		Order("click_count DESC"). // Most clicked ads first
-		Limit(filters.Limit).
+	groupBy := strings.Join(groupColumns(filters), ", ")
+
+	// With a comparison, the source rows span both periods and every
+	// current-period aggregate is restricted to in_current
+	current := func(aggregate string) string {
+		if filters.comparing() {
+			return aggregate + " FILTER (WHERE in_current)"
+		}
+		return aggregate
+	}
+
+	// CTR is only computed in SQL when sorting by it, against the same
+	// impressions of the group as addCTRToResults or, with a comparison,
+	// addComparisonImpressions
+	ctr := ""
+	var ctrArgs []interface{}
+	if filters.Sort == SortCTR {
+		impressions, args := groupImpressionsExpr(filters)
+		ctr = `,
+			` + impressions + ` as impressions,
+			COALESCE(` + current("COUNT(*)") + ` * 100.0 / NULLIF(` + impressions + `, 0), 0) as ctr`
+		ctrArgs = append(args, args...)
+	}
+
+	// Approximate unique counts are filled in from rollups afterwards,
+	// skipping the expensive DISTINCT over raw clicks
+	uniqueExpr := "COUNT(DISTINCT " + uniqueIdentityExprs[filters.Identity] + ")"
+	uniqueClicks := current(uniqueExpr)
+	if filters.Approximate {
+		uniqueClicks = "0"
+	}
+
+	// Groups with clicks in only the comparison period are kept so drops
+	// to zero show up; their current averages are 0
+	lastUpdated := "MAX(created_at)"
+	comparison := ""
+	if filters.comparing() {
+		lastUpdated = "COALESCE(" + current("MAX(created_at)") + ", MAX(created_at))"
+		comparison = `,
+			COUNT(*) FILTER (WHERE NOT in_current) as compare_click_count,
+			` + uniqueExpr + ` FILTER (WHERE NOT in_current) as compare_unique_clicks,
+			COALESCE(AVG(playback_time_sec) FILTER (WHERE NOT in_current), 0) as compare_avg_playback_time,
+			COALESCE(AVG(watched_percent) FILTER (WHERE NOT in_current), 0) as compare_avg_watch_percent`
+	}
+
+	selection := groupBy + `,
+			` + current("COUNT(*)") + ` as click_count,
+			` + uniqueClicks + ` as unique_clicks,
+			COALESCE(` + current("AVG(playback_time_sec)") + `, 0) as avg_playback_time,
+			COALESCE(` + current("AVG(watched_percent)") + `, 0) as avg_watch_percent,
+			` + lastUpdated + ` as last_updated
+		` + ctr + comparison
+
+	return s.clickSource(ctx, filters).
+		Select(selection, ctrArgs...).
+		Group(groupBy).
+		Order(orderClause(filters)). // Most clicked ads first by default
+		Limit(filters.Limit + 1).    // One extra row tells whether there is a next page
 		Offset(filters.Offset)
+}
+
+// clickSource returns the clicks matching filters. With a comparison it is
+// a derived table, still aliased clicks, holding the clicks of both periods
+// and an in_current flag, so that both are aggregated in a single scan.
+func (s *Service) clickSource(ctx context.Context, filters AnalyticsFilters) *gorm.DB {
+	db := s.DB.WithContext(ctx)
+	if !filters.comparing() {
+		return applyClickFilters(s.clicksTable(db, filters), filters)
+	}
+
+	unbounded := filters
+	unbounded.Since, unbounded.Until = time.Time{}, time.Time{}
+	source := applyClickFilters(s.clicksTable(s.DB, filters), unbounded).
+		Select("clicks.*, (created_at >= ? AND created_at <= ?) as in_current", filters.Since, filters.Until).
+		Where("(created_at >= ? AND created_at <= ?) OR (created_at >= ? AND created_at <= ?)",
+			filters.Since, filters.Until, filters.CompareSince, filters.CompareUntil)
+
+	return db.Table("(?) as clicks", source)
+}
+
+// clicksTable returns the clicks table on db or, when filters need them, a
+// derived table still named clicks whose rows also carry the campaign_id
+// of the clicked ad and the advertiser_id of that campaign.
+func (s *Service) clicksTable(db *gorm.DB, filters AnalyticsFilters) *gorm.DB {
+	if !filters.needsCampaigns() {
+		return db.Table("clicks")
+	}
+
+	joined := s.DB.Table("clicks").
+		Select("clicks.*, ads.campaign_id, campaigns.advertiser_id").
+		Joins("LEFT JOIN ads ON ads.id = clicks.ad_id").
+		Joins("LEFT JOIN campaigns ON campaigns.id = ads.campaign_id")
+	return db.Table("(?) as clicks", joined)
+}
+
+// countAnalyticsRows counts the result rows buildAnalyticsQuery would
+// return without pagination, i.e. the distinct groups matching the filters.
+func (s *Service) countAnalyticsRows(ctx context.Context, filters AnalyticsFilters, total *int64) error {
+	groupBy := strings.Join(groupColumns(filters), ", ")
+	groups := s.clickSource(ctx, filters).
+		Select(groupBy).
+		Group(groupBy)
+
+	return s.DB.WithContext(ctx).
+		Table("(?) as analytics_groups", groups).
+		Count(total).Error
+}
+
+// groupColumns returns the clicks columns results are grouped by: the ad,
+// campaign or advertiser, then any dimensions.
+func groupColumns(filters AnalyticsFilters) []string {
+	columns := []string{leadColumn(filters)}
+	for _, dimension := range filters.GroupBy {
+		columns = append(columns, analyticsDimensions[dimension])
+	}
+	return columns
+}
+
+// leadColumn returns the column identifying a result row's ad, or its
+// campaign or advertiser when rolled up.
+func leadColumn(filters AnalyticsFilters) string {
+	if column, ok := rollUpColumns[filters.RollUp]; ok {
+		return column
+	}
+	return "ad_id"
+}
+
+// applyClickFilters restricts a clicks query to the filter's ad, campaign,
+// advertiser, time range and dimension values. Clicks flagged as
+// fraudulent are dropped unless IncludeFraud is set. Campaign filters and
+// rollups need the query to be on clicksTable.
+func applyClickFilters(query *gorm.DB, filters AnalyticsFilters) *gorm.DB {
+	if !filters.IncludeFraud {
+		query = query.Where("NOT is_fraudulent")
+	}
 
-	// Apply filters
 	if filters.AdID != 0 {
 		query = query.Where("ad_id = ?", filters.AdID)
 	}
 
+	if filters.CampaignID != 0 {
+		query = query.Where("campaign_id = ?", filters.CampaignID)
+	}
+
+	if filters.AdvertiserID != 0 {
+		query = query.Where("advertiser_id = ?", filters.AdvertiserID)
+	}
+
+	// Rollups leave out ads outside any campaign
+	if filters.rolledUp() {
+		query = query.Where(leadColumn(filters) + " IS NOT NULL")
+	}
+
 	if !filters.Since.IsZero() {
 		query = query.Where("created_at >= ?", filters.Since)
 	}
@@ -208,31 +610,263 @@ func (s *Service) buildAnalyticsQuery(ctx context.Context, filters AnalyticsFilt
 		query = query.Where("created_at <= ?", filters.Until)
 	}
 
+	for _, df := range filters.dimensionFilters() {
+		if df.Folded {
+			query = query.Where("LOWER("+df.Column+") = ?", df.Value)
+		} else {
+			query = query.Where(df.Column+" = ?", df.Value)
+		}
+	}
+
 	return query
 }
 
-// addCTRToResults calculates CTR by fetching impression data
-func (s *Service) addCTRToResults(ctx context.Context, results []AdAnalytics) {
+// addSketchUniques estimates unique clicks for each result by merging the
+// hourly HLL rollups of the whole hours in the filter range. The partial
+// hours at either end are read from clicks and added to the same sketch,
+// so the estimate covers the range exactly. Estimates carry a relative
+// standard error of sketch.HLLStdError and never exceed the click count.
+func (s *Service) addSketchUniques(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) error {
 	if len(results) == 0 {
-		return
+		return nil
+	}
+
+	until := filters.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+	from, to, whole := wholeHours(filters.Since, until)
+	merged := make(map[int]*sketch.HLL)
+
+	if whole {
+		column := identitySketchColumns[filters.Identity]
+		query := s.DB.WithContext(ctx).
+			Table("click_rollups").
+			Select("ad_id, "+column+" as sketch").
+			Where("ad_id IN ?", resultAdIDs(results)).
+			Where(column+" IS NOT NULL").
+			Where("bucket_start < ?", to)
+		if !from.IsZero() {
+			query = query.Where("bucket_start >= ?", from)
+		}
+		if err := mergeSketchRows(query, merged); err != nil {
+			return err
+		}
+	}
+
+	if err := s.addEdgeIdentities(ctx, filters, results, from, to, until, whole, merged); err != nil {
+		return err
+	}
+
+	for i := range results {
+		if hll, ok := merged[results[i].AdID]; ok {
+			results[i].UniqueClicks = min(int64(hll.Estimate()), results[i].ClickCount)
+		}
+		results[i].UniqueError = sketch.HLLStdError
+	}
+	return nil
+}
+
+// wholeHours returns the whole hours [from, to) within [since, until],
+// whose rollups can be merged as they are. from is zero if since is, and
+// whole is false if the range spans no whole hour.
+func wholeHours(since, until time.Time) (from, to time.Time, whole bool) {
+	if !since.IsZero() {
+		from = since.UTC().Truncate(time.Hour)
+		if from.Before(since) {
+			from = from.Add(time.Hour)
+		}
+	}
+	to = until.UTC().Truncate(time.Hour)
+	return from, to, from.Before(to)
+}
+
+// addEdgeIdentities adds the identities of the clicks outside the whole
+// hours [from, to) to each ad's sketch: the partial hours at either end of
+// the range, or the whole range if it spans no whole hour.
+func (s *Service) addEdgeIdentities(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics, from, to, until time.Time, whole bool, merged map[int]*sketch.HLL) error {
+	query := s.DB.WithContext(ctx).
+		Table("clicks").
+		Select("DISTINCT ad_id, "+uniqueIdentityExprs[filters.Identity]+" as identity").
+		Where("NOT is_fraudulent").
+		Where("ad_id IN ?", resultAdIDs(results))
+
+	if whole {
+		edges := s.DB.Where("created_at >= ? AND created_at <= ?", to, until)
+		if !from.IsZero() {
+			edges = edges.Or("created_at >= ? AND created_at < ?", filters.Since, from)
+		}
+		query = query.Where(edges)
+	} else {
+		query = query.Where("created_at >= ? AND created_at <= ?", filters.Since, until)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			adID     int
+			identity string
+		)
+		if err := rows.Scan(&adID, &identity); err != nil {
+			return err
+		}
+		hll, ok := merged[adID]
+		if !ok {
+			hll = sketch.NewHLL()
+			merged[adID] = hll
+		}
+		hll.AddString(identity)
+	}
+	return rows.Err()
+}
+
+// mergeSketchRows merges the (ad_id, sketch) rows of query into merged.
+func mergeSketchRows(query *gorm.DB, merged map[int]*sketch.HLL) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			adID int
+			data []byte
+		)
+		if err := rows.Scan(&adID, &data); err != nil {
+			return err
+		}
+
+		bucket := &sketch.HLL{}
+		if err := bucket.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		if acc, ok := merged[adID]; ok {
+			acc.Merge(bucket)
+		} else {
+			merged[adID] = bucket
+		}
+	}
+	return rows.Err()
+}
+
+// addFraudulentClicks counts the flagged clicks in each result group over
+// the filter range, whether or not the figures include them.
+func (s *Service) addFraudulentClicks(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	flagged := filters
+	flagged.IncludeFraud = true
+
+	columns := groupColumns(filters)
+	groupBy := strings.Join(columns, ", ")
+	query := s.clicksTable(s.DB.WithContext(ctx), filters).
+		Select(groupBy+", COUNT(*) as fraudulent").
+		Where(columns[0]+" IN ?", resultGroupIDs(filters, results)).
+		Where("is_fraudulent").
+		Group(groupBy)
+
+	rows, err := applyClickFilters(query, flagged).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var (
+			groupID    int
+			dims       = make([]sql.NullString, len(columns)-1)
+			count      int64
+			scanTarget = []interface{}{&groupID}
+		)
+		for i := range dims {
+			scanTarget = append(scanTarget, &dims[i])
+		}
+		scanTarget = append(scanTarget, &count)
+
+		if err := rows.Scan(scanTarget...); err != nil {
+			return err
+		}
+
+		parts := []string{fmt.Sprint(groupID)}
+		for _, d := range dims {
+			parts = append(parts, d.String)
+		}
+		counts[strings.Join(parts, "\x00")] = count
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	var adIDs []int
-	for _, result := range results {
-		adIDs = append(adIDs, result.AdID)
+	for i := range results {
+		results[i].FraudulentClicks = counts[resultGroupKey(filters, results[i])]
+	}
+	return nil
+}
+
+// addCappedRequests sums the hourly serving rollups overlapping the filter
+// range for each result's ad, so the range is widened to whole hours.
+func (s *Service) addCappedRequests(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	query := s.DB.WithContext(ctx).
+		Table("serving_rollups").
+		Select("ad_id, SUM(capped_requests) as capped_requests").
+		Where("ad_id IN ?", resultAdIDs(results)).
+		Group("ad_id")
+
+	if !filters.Since.IsZero() {
+		query = query.Where("bucket_start >= ?", filters.Since.UTC().Truncate(time.Hour))
+	}
+	if !filters.Until.IsZero() {
+		query = query.Where("bucket_start <= ?", filters.Until)
+	}
+
+	var rows []struct {
+		AdID           int
+		CappedRequests int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	capped := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		capped[row.AdID] = row.CappedRequests
+	}
+	for i := range results {
+		results[i].CappedRequests = capped[results[i].AdID]
+	}
+	return nil
+}
+
+// addCTRToResults calculates CTR by fetching impression data
+func (s *Service) addCTRToResults(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) {
+	if len(results) == 0 {
+		return
 	}
 
 	type ImpressionData struct {
-		AdID        int   `json:"ad_id"`
+		GroupID     int   `json:"group_id"`
 		Impressions int64 `json:"impressions"`
 	}
 
+	column := groupImpressionsColumn(filters)
 	var impressions []ImpressionData
-	err := s.DB.WithContext(ctx).
-		Table("impressions").
-		Select("ad_id, COUNT(*) as impressions").
-		Where("ad_id IN ?", adIDs).
-		Group("ad_id").
+	err := groupImpressions(s.DB.WithContext(ctx), filters).
+		Select(column+" as group_id, COUNT(*) as impressions").
+		Where(column+" IN ?", resultGroupIDs(filters, results)).
+		Group(column).
 		Scan(&impressions).Error
 
 	if err != nil {
@@ -243,95 +877,174 @@ func (s *Service) addCTRToResults(ctx context.Context, results []AdAnalytics) {
 	// Create lookup map for impressions
 	impressionMap := make(map[int]int64)
 	for _, imp := range impressions {
-		impressionMap[imp.AdID] = imp.Impressions
+		impressionMap[imp.GroupID] = imp.Impressions
 	}
 
 	// Calculate CTR for each result
 	for i := range results {
-		if impressions, exists := impressionMap[results[i].AdID]; exists && impressions > 0 {
+		if impressions, exists := impressionMap[resultGroupID(filters, results[i])]; exists && impressions > 0 {
 			results[i].Impressions = impressions
 			results[i].CTR = (float64(results[i].ClickCount) / float64(impressions)) * 100
 		}
 	}
 
 	observability.Logger.Debug("CTR calculated for analytics results",
-		zap.Int("ads_with_ctr", len(impressionMap)))
+		zap.Int("groups_with_ctr", len(impressionMap)))
 }
 
-// updateCache updates the in-memory cache with fresh data
-func (s *Service) updateCache(results []AdAnalytics) {
+// addComparisonImpressions counts each row's impressions in the current and
+// the comparison range, and sets its CTR over the current range along with
+// the comparison of both. All-time impressions would make CTRs of the two
+// periods incomparable.
+func (s *Service) addComparisonImpressions(ctx context.Context, filters AnalyticsFilters, results []AdAnalytics) error {
 	if len(results) == 0 {
-		return
+		return nil
+	}
+
+	type periodImpressions struct {
+		GroupID            int
+		Impressions        int64
+		CompareImpressions int64
 	}
 
-	s.cache.mu.Lock()
-	defer s.cache.mu.Unlock()
+	column := groupImpressionsColumn(filters)
+	var counts []periodImpressions
+	err := groupImpressions(s.DB.WithContext(ctx), filters).
+		Select(column+` as group_id,
+			COUNT(*) FILTER (WHERE impressions.created_at >= ? AND impressions.created_at <= ?) as impressions,
+			COUNT(*) FILTER (WHERE impressions.created_at >= ? AND impressions.created_at <= ?) as compare_impressions`,
+			filters.Since, filters.Until, filters.CompareSince, filters.CompareUntil).
+		Where(column+" IN ?", resultGroupIDs(filters, results)).
+		Where("(impressions.created_at >= ? AND impressions.created_at <= ?) OR (impressions.created_at >= ? AND impressions.created_at <= ?)",
+			filters.Since, filters.Until, filters.CompareSince, filters.CompareUntil).
+		Group(column).
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
 
-	updated := 0
-	for _, result := range results {
-		s.cache.metrics[result.AdID] = &result
-		updated++
+	byGroup := make(map[int]periodImpressions, len(counts))
+	for _, count := range counts {
+		byGroup[count.GroupID] = count
 	}
 
-	observability.Logger.Debug("Analytics cache updated",
-		zap.Int("ads_updated", updated))
+	ctr := func(clicks, impressions int64) float64 {
+		if impressions == 0 {
+			return 0
+		}
+		return float64(clicks) * 100 / float64(impressions)
+	}
+	for i := range results {
+		count := byGroup[resultGroupID(filters, results[i])]
+		results[i].Impressions = count.Impressions
+		results[i].CTR = ctr(results[i].ClickCount, count.Impressions)
+		if results[i].Comparison != nil {
+			results[i].Comparison.Impressions = newMetricDelta(float64(count.Impressions), float64(count.CompareImpressions))
+			results[i].Comparison.CTR = newMetricDelta(results[i].CTR, ctr(results[i].CompareClickCount, count.CompareImpressions))
+		}
+	}
+	return nil
+}
+
+// groupImpressions returns the impressions table joined as far as the
+// result rows' campaign or advertiser.
+func groupImpressions(db *gorm.DB, filters AnalyticsFilters) *gorm.DB {
+	query := db.Table("impressions")
+	if filters.rolledUp() {
+		query = query.Joins("JOIN ads ON ads.id = impressions.ad_id")
+	}
+	if filters.RollUp == RollUpAdvertiser {
+		query = query.Joins("JOIN campaigns ON campaigns.id = ads.campaign_id")
+	}
+	return query
+}
+
+// groupImpressionsColumn returns the column of groupImpressions matching
+// leadColumn.
+func groupImpressionsColumn(filters AnalyticsFilters) string {
+	switch filters.RollUp {
+	case RollUpCampaign:
+		return "ads.campaign_id"
+	case RollUpAdvertiser:
+		return "campaigns.advertiser_id"
+	}
+	return "impressions.ad_id"
+}
+
+// groupImpressionsExpr is a correlated subquery counting the impressions
+// of the clicks row's group, for sorting by CTR in SQL, and its arguments.
+// Impressions are all-time, or within the current range when comparing.
+func groupImpressionsExpr(filters AnalyticsFilters) (string, []interface{}) {
+	var where string
+	switch filters.RollUp {
+	case RollUpCampaign:
+		where = "FROM impressions i JOIN ads a ON a.id = i.ad_id WHERE a.campaign_id = clicks.campaign_id"
+	case RollUpAdvertiser:
+		where = "FROM impressions i JOIN ads a ON a.id = i.ad_id JOIN campaigns c ON c.id = a.campaign_id WHERE c.advertiser_id = clicks.advertiser_id"
+	default:
+		where = "FROM impressions i WHERE i.ad_id = clicks.ad_id"
+	}
+
+	if filters.comparing() {
+		return "(SELECT COUNT(*) " + where + " AND i.created_at >= ? AND i.created_at <= ?)",
+			[]interface{}{filters.Since, filters.Until}
+	}
+	return "(SELECT COUNT(*) " + where + ")", nil
 }
 
 // startCacheRefresh runs background cache refresh for real-time analytics
-func (s *Service) startCacheRefresh() {
+// until ctx is done
+func (s *Service) startCacheRefresh(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Minute) // Refresh every minute
 	defer ticker.Stop()
 
 	observability.Logger.Info("Analytics cache refresh started")
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !s.refresher.IsLeader() {
+			continue
+		}
 		s.refreshTopAds()
 	}
 }
 
-// refreshTopAds refreshes cache with most active ads from the last hour
+// refreshTopAds refreshes the page served to a bare real_time=true request,
+// parsed like GET /ads/analytics so the warmed entry has the same key
 func (s *Service) refreshTopAds() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundLoadTimeout)
 	defer cancel()
 
-	filters := AnalyticsFilters{
-		TimeWindow: time.Hour,
-		Limit:      100, // Cache top 100 ads
-		Offset:     0,
-		IncludeCTR: false, // Skip CTR for background refresh to save time
+	filters, err := ParseFilters(url.Values{"real_time": {"true"}})
+	if err != nil {
+		observability.Logger.Error("Invalid analytics cache refresh filters", zap.Error(err))
+		return
+	}
+
+	if err := s.prepareFilters(&filters); err != nil {
+		observability.Logger.Error("Invalid analytics cache refresh filters", zap.Error(err))
+		return
 	}
 
-	results, err := s.fetchFromDatabase(ctx, filters)
+	key := cacheKey(filters)
+	page, err, _ := s.flights.Do(ctx, key, func(ctx context.Context) (*AnalyticsPage, error) {
+		return s.loadAndCache(ctx, key, filters)
+	})
 	if err != nil {
 		observability.Logger.Error("Failed to refresh analytics cache", zap.Error(err))
 		return
 	}
 
 	observability.Logger.Debug("Analytics cache refreshed",
-		zap.Int("ads_cached", len(results)))
+		zap.Int("ads_cached", len(page.Data)))
 }
 
 // GetCacheStats returns cache statistics for monitoring
 func (s *Service) GetCacheStats() map[string]interface{} {
-	s.cache.mu.RLock()
-	defer s.cache.mu.RUnlock()
-
-	validEntries := 0
-	expiredEntries := 0
-	now := time.Now()
-
-	for _, cached := range s.cache.metrics {
-		if now.Sub(cached.LastUpdated) < s.cache.ttl {
-			validEntries++
-		} else {
-			expiredEntries++
-		}
-	}
-
-	return map[string]interface{}{
-		"total_entries":   len(s.cache.metrics),
-		"valid_entries":   validEntries,
-		"expired_entries": expiredEntries,
-		"ttl_minutes":     s.cache.ttl.Minutes(),
-	}
+	return s.cache.Stats()
 }
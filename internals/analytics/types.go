@@ -1,26 +1,102 @@
 package analytics
 
-import (
-	"sync"
-	"time"
-)
+import "time"
+
+type AdAnalytics struct {
+	AdID             int             `json:"ad_id,omitempty"`
+	CampaignID       int             `json:"campaign_id,omitempty"`   // Set instead of AdID when rolled up by campaign
+	AdvertiserID     int             `json:"advertiser_id,omitempty"` // Set instead of AdID when rolled up by advertiser
+	DeviceType       string          `json:"device_type,omitempty"`
+	Browser          string          `json:"browser,omitempty"`
+	OS               string          `json:"os,omitempty"`
+	Country          string          `json:"country,omitempty"`
+	Region           string          `json:"region,omitempty"`
+	ClickCount       int64           `json:"click_count"`
+	UniqueClicks     int64           `json:"unique_clicks"`
+	UniqueError      float64         `json:"unique_clicks_error,omitempty"` // Relative std error when estimated from sketches
+	AvgPlaybackTime  float64         `json:"avg_playback_time"`
+	AvgWatchPercent  float64         `json:"avg_watch_percent"`
+	PlaybackP50      float64         `json:"playback_p50,omitempty"`
+	PlaybackP90      float64         `json:"playback_p90,omitempty"`
+	PlaybackP99      float64         `json:"playback_p99,omitempty"`
+	WatchQuartiles   *WatchQuartiles `json:"watch_quartiles,omitempty" gorm:"-"`
+	CTR              float64         `json:"ctr,omitempty"`
+	Impressions      int64           `json:"impressions,omitempty"`
+	FraudulentClicks int64           `json:"fraudulent_clicks" gorm:"-"` // Flagged clicks left out of the figures above
+	CappedRequests   int64           `json:"capped_requests" gorm:"-"`   // Ad requests withheld by the frequency cap; per ad only
+	LastUpdated      time.Time       `json:"last_updated"`
+	Comparison       *Comparison     `json:"comparison,omitempty" gorm:"-"`
 
-// AnalyticsCache provides thread-safe in-memory caching for real-time metrics
-type AnalyticsCache struct {
-	mu      sync.RWMutex
-	metrics map[int]*AdAnalytics
-	ttl     time.Duration
+	// Comparison-period aggregates scanned alongside the current ones;
+	// exposed through Comparison
+	CompareClickCount      int64   `json:"-"`
+	CompareUniqueClicks    int64   `json:"-"`
+	CompareAvgPlaybackTime float64 `json:"-"`
+	CompareAvgWatchPercent float64 `json:"-"`
 }
 
-type AdAnalytics struct {
-	AdID            int       `json:"ad_id"`
-	ClickCount      int64     `json:"click_count"`
-	UniqueClicks    int64     `json:"unique_clicks"`
-	AvgPlaybackTime float64   `json:"avg_playback_time"`
-	AvgWatchPercent float64   `json:"avg_watch_percent"`
-	CTR             float64   `json:"ctr,omitempty"`
-	Impressions     int64     `json:"impressions,omitempty"`
-	LastUpdated     time.Time `json:"last_updated"`
+// Comparison holds each metric's value in the comparison period and how
+// the current period differs from it.
+type Comparison struct {
+	ClickCount      MetricDelta `json:"click_count"`
+	UniqueClicks    MetricDelta `json:"unique_clicks"`
+	AvgPlaybackTime MetricDelta `json:"avg_playback_time"`
+	AvgWatchPercent MetricDelta `json:"avg_watch_percent"`
+	Impressions     MetricDelta `json:"impressions"`
+	CTR             MetricDelta `json:"ctr"`
+}
+
+// MetricDelta compares one metric against the comparison period.
+// ChangePercent is nil when the previous value is zero.
+type MetricDelta struct {
+	Previous      float64  `json:"previous"`
+	Change        float64  `json:"change"`
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+func newMetricDelta(current, previous float64) MetricDelta {
+	delta := MetricDelta{Previous: previous, Change: current - previous}
+	if previous != 0 {
+		percent := delta.Change * 100 / previous
+		delta.ChangePercent = &percent
+	}
+	return delta
+}
+
+// applyComparison fills Comparison from the scanned comparison aggregates.
+func (a *AdAnalytics) applyComparison() {
+	a.Comparison = &Comparison{
+		ClickCount:      newMetricDelta(float64(a.ClickCount), float64(a.CompareClickCount)),
+		UniqueClicks:    newMetricDelta(float64(a.UniqueClicks), float64(a.CompareUniqueClicks)),
+		AvgPlaybackTime: newMetricDelta(a.AvgPlaybackTime, a.CompareAvgPlaybackTime),
+		AvgWatchPercent: newMetricDelta(a.AvgWatchPercent, a.CompareAvgWatchPercent),
+	}
+}
+
+// TimeRange is an inclusive time range.
+type TimeRange struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// AnalyticsPage is one page of analytics results.
+type AnalyticsPage struct {
+	Data       []AdAnalytics
+	Total      int64 // Result rows matching the filters across all pages
+	Limit      int
+	Offset     int
+	HasMore    bool
+	NextCursor string     // Empty on the last page
+	FreshUntil time.Time  // After this the page is stale and is revalidated when served
+	Comparison *TimeRange // Comparison period, when one was requested
+}
+
+// WatchQuartiles counts clicks that watched at least each quartile of the ad.
+type WatchQuartiles struct {
+	Reached25  int64 `json:"reached_25"`
+	Reached50  int64 `json:"reached_50"`
+	Reached75  int64 `json:"reached_75"`
+	Reached100 int64 `json:"reached_100"`
 }
 
 type AnalyticsFilters struct {
@@ -32,4 +108,148 @@ type AnalyticsFilters struct {
 	Offset     int           `json:"offset,omitempty"`
 	RealTime   bool          `json:"real_time,omitempty"`   // Use cache for real-time data
 	IncludeCTR bool          `json:"include_ctr,omitempty"` // Calculate CTR
+	Identity   string        `json:"identity,omitempty"`    // Unique-user strategy, see uniqueIdentityExprs
+	// Approximate serves unique clicks from hourly HLL rollups instead of
+	// COUNT(DISTINCT), reading the partial hours at the ends from clicks.
+	Approximate bool `json:"approximate,omitempty"`
+	// IncludeDistribution adds playback percentiles and watch quartiles
+	IncludeDistribution bool `json:"include_distribution,omitempty"`
+	// IncludeFraud counts clicks flagged by fraud detection, which are
+	// excluded by default
+	IncludeFraud bool `json:"include_fraud,omitempty"`
+
+	// Ordering and cursor pagination; Cursor overrides Offset and the time range
+	Sort    string `json:"sort,omitempty"` // One of the Sort* fields, default click_count
+	SortAsc bool   `json:"sort_asc,omitempty"`
+	Cursor  string `json:"cursor,omitempty"`
+
+	// Period-over-period comparison: one of the Compare* modes. Relative
+	// modes derive CompareSince/CompareUntil from the resolved range.
+	Compare      string    `json:"compare,omitempty"`
+	CompareSince time.Time `json:"compare_since,omitempty"`
+	CompareUntil time.Time `json:"compare_until,omitempty"`
+
+	// RollUp aggregates the ads of each campaign or advertiser into one row
+	// (one of the RollUp* levels); results are per ad by default. Ads are
+	// attributed to the campaign they are in now, and ads outside any
+	// campaign are left out of rollups.
+	RollUp       string `json:"roll_up,omitempty"`
+	CampaignID   int    `json:"campaign_id,omitempty"`
+	AdvertiserID int    `json:"advertiser_id,omitempty"`
+
+	// Dimensional breakdown and filters (see analyticsDimensions)
+	GroupBy    []string `json:"group_by,omitempty"` // e.g. device, country
+	DeviceType string   `json:"device_type,omitempty"`
+	Browser    string   `json:"browser,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	Country    string   `json:"country,omitempty"`
+	Region     string   `json:"region,omitempty"`
+
+	// rolling is set when the range is the last TimeWindow up to now, so
+	// the page is cached by the window rather than its resolved bounds
+	rolling bool
+}
+
+// Comparison modes.
+const (
+	ComparePreviousPeriod = "previous_period" // Same length, immediately before the range
+	ComparePreviousYear   = "previous_year"   // The range shifted back one year
+	CompareCustom         = "custom"          // Explicit compare_since/compare_until
+)
+
+// Rollup levels.
+const (
+	RollUpCampaign   = "campaign"
+	RollUpAdvertiser = "advertiser"
+)
+
+// rollUpColumns maps each rollup level to the column that replaces ad_id
+// as the leading group column.
+var rollUpColumns = map[string]string{
+	RollUpCampaign:   "campaign_id",
+	RollUpAdvertiser: "advertiser_id",
+}
+
+// rolledUp reports whether results aggregate several ads per row.
+func (f AnalyticsFilters) rolledUp() bool {
+	return f.RollUp != ""
+}
+
+// needsCampaigns reports whether the click source must carry each click's
+// campaign and advertiser.
+func (f AnalyticsFilters) needsCampaigns() bool {
+	return f.rolledUp() || f.CampaignID != 0 || f.AdvertiserID != 0
+}
+
+// comparing reports whether a comparison period was requested.
+func (f AnalyticsFilters) comparing() bool {
+	return f.Compare != ""
+}
+
+// Identity strategies for counting unique users.
+const (
+	IdentityIP          = "ip"          // Raw client IP (legacy behaviour)
+	IdentityFingerprint = "fingerprint" // Server-derived salted hash of IP+UA
+	IdentityVisitor     = "visitor"     // Client visitor id, falling back to fingerprint, then IP
+)
+
+// uniqueIdentityExprs maps each identity strategy to the expression counted
+// DISTINCT for unique clicks. Fallbacks are prefixed so a visitor id can
+// never collide with a fingerprint or IP, and clicks recorded before the
+// identity columns existed still count by IP.
+var uniqueIdentityExprs = map[string]string{
+	IdentityIP:          "user_ip",
+	IdentityFingerprint: "COALESCE('f:' || NULLIF(fingerprint, ''), 'i:' || user_ip)",
+	IdentityVisitor:     "COALESCE('v:' || NULLIF(visitor_id, ''), 'f:' || NULLIF(fingerprint, ''), 'i:' || user_ip)",
+}
+
+// identitySketchColumns maps each identity strategy to its HLL column on
+// click_rollups.
+var identitySketchColumns = map[string]string{
+	IdentityIP:          "ip_sketch",
+	IdentityFingerprint: "fingerprint_sketch",
+	IdentityVisitor:     "visitor_sketch",
+}
+
+// analyticsDimensions maps the group_by/filter names accepted by the API to
+// their column on the clicks table.
+var analyticsDimensions = map[string]string{
+	"device":  "device_type",
+	"browser": "browser",
+	"os":      "os",
+	"country": "country",
+	"region":  "region",
+}
+
+// dimensionFilter is an equality filter on a clicks dimension column. A
+// folded filter's value is lower case and matched case-insensitively, for
+// columns stored in display case such as "Chrome" or "macOS".
+type dimensionFilter struct {
+	Column string
+	Value  string
+	Folded bool
+}
+
+// dimensionFilters returns the dimension equality filters that are set, in
+// a stable order.
+func (f AnalyticsFilters) dimensionFilters() []dimensionFilter {
+	var filters []dimensionFilter
+	for _, df := range []dimensionFilter{
+		{"device_type", f.DeviceType, false},
+		{"browser", f.Browser, true},
+		{"os", f.OS, true},
+		{"country", f.Country, false},
+		{"region", f.Region, false},
+	} {
+		if df.Value != "" {
+			filters = append(filters, df)
+		}
+	}
+	return filters
+}
+
+// hasDimensions reports whether results are broken down or filtered by a
+// click dimension.
+func (f AnalyticsFilters) hasDimensions() bool {
+	return len(f.GroupBy) > 0 || len(f.dimensionFilters()) > 0
 }
@@ -0,0 +1,269 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lystage-proj/internals/models"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultConfidence is the confidence level of variant intervals and tests
+// unless one is requested.
+const DefaultConfidence = 0.95
+
+// VariantTest is the significance test run by VariantReport.
+const VariantTest = "two_proportion_z_test"
+
+var errAdNotFound = errors.New("ad not found")
+
+// VariantOptions select how variants are compared.
+type VariantOptions struct {
+	Confidence float64 // In (0, 1), default DefaultConfidence
+	ControlID  uint    // Variant the others are tested against, default the oldest
+}
+
+// VariantReport compares the CTR of an ad's creative variants over a time
+// range.
+type VariantReport struct {
+	AdID       int            `json:"ad_id"`
+	Since      time.Time      `json:"since"`
+	Until      time.Time      `json:"until"`
+	Confidence float64        `json:"confidence"`
+	Test       string         `json:"test"`
+	ControlID  uint           `json:"control_variant_id,omitempty"`
+	Alpha      float64        `json:"alpha"` // Per-comparison significance level, Bonferroni-corrected
+	Variants   []VariantStats `json:"variants"`
+}
+
+// VariantStats are one variant's results. CTRs are percentages, with a
+// Wilson score interval at the report's confidence. The comparison fields
+// are against the control, and left out for the control itself and when
+// either has no impressions.
+type VariantStats struct {
+	VariantID   uint    `json:"variant_id"`
+	Name        string  `json:"name,omitempty"`   // Empty for deleted variants
+	Status      string  `json:"status,omitempty"` // Empty for deleted variants
+	Weight      int     `json:"weight"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+	CTRLower    float64 `json:"ctr_lower"`
+	CTRUpper    float64 `json:"ctr_upper"`
+	Control     bool    `json:"control,omitempty"`
+
+	Lift        *float64 `json:"lift,omitempty"` // Relative CTR change over the control, in percent
+	ZScore      *float64 `json:"z_score,omitempty"`
+	PValue      *float64 `json:"p_value,omitempty"` // Two-sided
+	Significant bool     `json:"significant"`
+}
+
+// VariantReport counts the impressions and clicks of each variant of
+// filters.AdID within the time range, leaving out flagged clicks unless
+// filters.IncludeFraud, and tests every variant against the control.
+// Only clicks through a token issued with the variant are attributed to
+// it.
+func (s *Service) VariantReport(ctx context.Context, filters AnalyticsFilters, opts VariantOptions) (*VariantReport, error) {
+	if filters.AdID <= 0 {
+		return nil, fmt.Errorf("%w: ad_id is required", errInvalidFilters)
+	}
+	if opts.Confidence == 0 {
+		opts.Confidence = DefaultConfidence
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		return nil, fmt.Errorf("%w: confidence must be between 0 and 1", errInvalidFilters)
+	}
+	filters.Cursor, filters.Compare = "", ""
+	if err := s.prepareFilters(&filters); err != nil {
+		return nil, err
+	}
+
+	var ad models.Ad
+	err := s.DB.WithContext(ctx).Preload("Variants").Select("id").First(&ad, filters.AdID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errAdNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[uint]*VariantStats)
+	for _, variant := range ad.Variants {
+		stats[variant.ID] = &VariantStats{
+			VariantID: variant.ID,
+			Name:      variant.Name,
+			Status:    variant.Status,
+			Weight:    variant.Weight,
+		}
+	}
+
+	impressions, err := s.variantCounts(ctx, s.DB.Model(&models.Impression{}), filters)
+	if err != nil {
+		return nil, fmt.Errorf("count variant impressions: %w", err)
+	}
+	clickQuery := s.DB.Model(&models.Click{})
+	if !filters.IncludeFraud {
+		clickQuery = clickQuery.Where("NOT is_fraudulent")
+	}
+	clicks, err := s.variantCounts(ctx, clickQuery, filters)
+	if err != nil {
+		return nil, fmt.Errorf("count variant clicks: %w", err)
+	}
+
+	// Deleted variants keep their events
+	for id, count := range impressions {
+		variantStats(stats, id).Impressions = count
+	}
+	for id, count := range clicks {
+		variantStats(stats, id).Clicks = count
+	}
+
+	report := &VariantReport{
+		AdID:       filters.AdID,
+		Since:      filters.Since,
+		Until:      filters.Until,
+		Confidence: opts.Confidence,
+		Test:       VariantTest,
+		Variants:   make([]VariantStats, 0, len(stats)),
+	}
+	for _, v := range stats {
+		report.Variants = append(report.Variants, *v)
+	}
+	sort.Slice(report.Variants, func(i, j int) bool {
+		return report.Variants[i].VariantID < report.Variants[j].VariantID
+	})
+	if len(report.Variants) == 0 {
+		return report, nil
+	}
+
+	report.ControlID = report.Variants[0].VariantID
+	if opts.ControlID != 0 {
+		if _, ok := stats[opts.ControlID]; !ok {
+			return nil, fmt.Errorf("%w: variant %d is not a variant of ad %d", errInvalidFilters, opts.ControlID, filters.AdID)
+		}
+		report.ControlID = opts.ControlID
+	}
+	compareVariants(report)
+	return report, nil
+}
+
+// variantCounts counts the ad's events in the range per variant.
+func (s *Service) variantCounts(ctx context.Context, query *gorm.DB, filters AnalyticsFilters) (map[uint]int64, error) {
+	query = query.WithContext(ctx).
+		Select("variant_id, COUNT(*) as count").
+		Where("ad_id = ? AND variant_id IS NOT NULL", filters.AdID).
+		Group("variant_id")
+	if !filters.Since.IsZero() {
+		query = query.Where("created_at >= ?", filters.Since)
+	}
+	if !filters.Until.IsZero() {
+		query = query.Where("created_at <= ?", filters.Until)
+	}
+
+	var rows []struct {
+		VariantID uint
+		Count     int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.VariantID] = row.Count
+	}
+	return counts, nil
+}
+
+func variantStats(stats map[uint]*VariantStats, id uint) *VariantStats {
+	if v, ok := stats[id]; ok {
+		return v
+	}
+	stats[id] = &VariantStats{VariantID: id}
+	return stats[id]
+}
+
+// compareVariants fills in the intervals of every variant and tests each
+// against the control. The significance level is split evenly between the
+// comparisons, so the chance of any false positive stays within
+// 1 - confidence.
+func compareVariants(report *VariantReport) {
+	z := normalQuantile(1 - (1-report.Confidence)/2)
+	report.Alpha = 1 - report.Confidence
+	if comparisons := len(report.Variants) - 1; comparisons > 1 {
+		report.Alpha /= float64(comparisons)
+	}
+
+	var control VariantStats
+	for _, v := range report.Variants {
+		if v.VariantID == report.ControlID {
+			control = v
+		}
+	}
+
+	for i := range report.Variants {
+		v := &report.Variants[i]
+		clicks := min(v.Clicks, v.Impressions) // Clicks on impressions before the range can exceed them
+		if v.Impressions > 0 {
+			v.CTR = percent(float64(clicks) / float64(v.Impressions))
+			lower, upper := wilsonInterval(clicks, v.Impressions, z)
+			v.CTRLower, v.CTRUpper = percent(lower), percent(upper)
+		}
+
+		if v.VariantID == report.ControlID {
+			v.Control = true
+			continue
+		}
+		if v.Impressions == 0 || control.Impressions == 0 {
+			continue
+		}
+		controlClicks := min(control.Clicks, control.Impressions)
+		controlRate := float64(controlClicks) / float64(control.Impressions)
+		if controlRate > 0 {
+			lift := percent((float64(clicks)/float64(v.Impressions) - controlRate) / controlRate)
+			v.Lift = &lift
+		}
+		if score, ok := twoProportionZ(controlClicks, control.Impressions, clicks, v.Impressions); ok {
+			pValue := math.Erfc(math.Abs(score) / math.Sqrt2)
+			v.ZScore, v.PValue = &score, &pValue
+			v.Significant = pValue < report.Alpha
+		}
+	}
+}
+
+// wilsonInterval is the Wilson score interval of a proportion of successes
+// in trials for the standard normal quantile z.
+func wilsonInterval(successes, trials int64, z float64) (float64, float64) {
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := z * z
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := z / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// twoProportionZ is the pooled z statistic for the difference of proportion
+// b over proportion a. It is not defined when neither or both have every
+// trial succeed.
+func twoProportionZ(successesA, trialsA, successesB, trialsB int64) (float64, bool) {
+	pA := float64(successesA) / float64(trialsA)
+	pB := float64(successesB) / float64(trialsB)
+	pooled := float64(successesA+successesB) / float64(trialsA+trialsB)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(trialsA) + 1/float64(trialsB)))
+	if se == 0 {
+		return 0, false
+	}
+	return (pB - pA) / se, true
+}
+
+// normalQuantile is the inverse of the standard normal CDF.
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+func percent(ratio float64) float64 {
+	return ratio * 100
+}
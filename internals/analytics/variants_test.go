@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWilsonInterval(t *testing.T) {
+	z := normalQuantile(0.975)
+	for _, tc := range []struct {
+		successes, trials int64
+		lower, upper      float64
+	}{
+		{10, 100, 0.055229, 0.174366},
+		{500, 1000, 0.469070, 0.530930},
+		{0, 50, 0, 0.071348},
+		{50, 50, 0.928652, 1},
+	} {
+		lower, upper := wilsonInterval(tc.successes, tc.trials, z)
+		if math.Abs(lower-tc.lower) > 1e-6 || math.Abs(upper-tc.upper) > 1e-6 {
+			t.Errorf("wilsonInterval(%d, %d) = [%f, %f], want [%f, %f]",
+				tc.successes, tc.trials, lower, upper, tc.lower, tc.upper)
+		}
+	}
+}
+
+func TestTwoProportionZ(t *testing.T) {
+	for _, tc := range []struct {
+		successesA, trialsA, successesB, trialsB int64
+		z                                        float64
+		ok                                       bool
+	}{
+		{50, 1000, 80, 1000, 2.721095, true},
+		{80, 1000, 50, 1000, -2.721095, true},
+		{100, 1000, 100, 1000, 0, true},
+		{0, 100, 0, 100, 0, false},
+		{100, 100, 50, 50, 0, false},
+	} {
+		z, ok := twoProportionZ(tc.successesA, tc.trialsA, tc.successesB, tc.trialsB)
+		if ok != tc.ok || math.Abs(z-tc.z) > 1e-6 {
+			t.Errorf("twoProportionZ(%d/%d, %d/%d) = %f, %t; want %f, %t",
+				tc.successesA, tc.trialsA, tc.successesB, tc.trialsB, z, ok, tc.z, tc.ok)
+		}
+	}
+}
+
+func TestNormalQuantile(t *testing.T) {
+	for p, want := range map[float64]float64{
+		0.5:   0,
+		0.975: 1.959964,
+		0.995: 2.575829,
+		0.025: -1.959964,
+	} {
+		if got := normalQuantile(p); math.Abs(got-want) > 1e-6 {
+			t.Errorf("normalQuantile(%v) = %f, want %f", p, got, want)
+		}
+	}
+}
+
+func TestCompareVariants(t *testing.T) {
+	report := &VariantReport{
+		Confidence: 0.95,
+		ControlID:  1,
+		Variants: []VariantStats{
+			{VariantID: 1, Impressions: 1000, Clicks: 50},
+			{VariantID: 2, Impressions: 1000, Clicks: 80},
+			{VariantID: 3},
+		},
+	}
+	compareVariants(report)
+
+	// Two comparisons share the 5% significance level
+	if math.Abs(report.Alpha-0.025) > 1e-9 {
+		t.Errorf("alpha = %v, want 0.025", report.Alpha)
+	}
+
+	control := report.Variants[0]
+	if !control.Control || control.Lift != nil || control.ZScore != nil || control.CTR != 5 {
+		t.Errorf("control = %+v", control)
+	}
+
+	variant := report.Variants[1]
+	switch {
+	case variant.CTR != 8:
+		t.Errorf("variant CTR = %v, want 8", variant.CTR)
+	case variant.Lift == nil || math.Abs(*variant.Lift-60) > 1e-9:
+		t.Errorf("variant lift = %v, want 60", variant.Lift)
+	case variant.ZScore == nil || math.Abs(*variant.ZScore-2.721095) > 1e-6:
+		t.Errorf("variant z = %v, want 2.721095", variant.ZScore)
+	case variant.PValue == nil || math.Abs(*variant.PValue-0.006507) > 1e-6:
+		t.Errorf("variant p = %v, want 0.006507", variant.PValue)
+	case !variant.Significant:
+		t.Error("variant is not significant at alpha 0.025")
+	case variant.CTRLower >= variant.CTR || variant.CTRUpper <= variant.CTR:
+		t.Errorf("variant interval [%v, %v] does not contain its CTR", variant.CTRLower, variant.CTRUpper)
+	}
+
+	unserved := report.Variants[2]
+	if unserved.ZScore != nil || unserved.Lift != nil || unserved.Significant || unserved.CTR != 0 {
+		t.Errorf("variant without impressions = %+v", unserved)
+	}
+}
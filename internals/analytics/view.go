@@ -1,9 +1,16 @@
 package analytics
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lystage-proj/internals/config"
 	"lystage-proj/internals/observability"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +23,12 @@ type Handler struct {
 
 type AnalyticsResponse struct {
 	Data       []AdAnalytics `json:"data"`
-	Total      int           `json:"total"`
+	Total      int64         `json:"total"` // Matching rows across all pages
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+	HasMore    bool          `json:"has_more"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Comparison *TimeRange    `json:"comparison,omitempty"` // Period each row's comparison covers
 	Generated  time.Time     `json:"generated_at"`
 	IsRealTime bool          `json:"is_real_time"`
 }
@@ -28,7 +40,7 @@ func NewHandler(service *Service) *Handler {
 // GetAdAnalytics handles GET /ads/analytics requests with real-time capabilities
 func (h *Handler) GetAdAnalytics(c *gin.Context) {
 	// Parse query parameters with enhanced options
-	filters, err := h.parseAnalyticsQueryParams(c)
+	filters, err := ParseFilters(c.Request.URL.Query())
 	if err != nil {
 		observability.Logger.Warn("Invalid analytics request parameters",
 			zap.Error(err),
@@ -47,7 +59,26 @@ func (h *Handler) GetAdAnalytics(c *gin.Context) {
 		zap.String("client_ip", c.ClientIP()))
 
 	// Fetch analytics data using enhanced service
-	results, err := h.service.FetchAdAnalyticsWithFilters(filters)
+	page, err := h.service.FetchAdAnalyticsWithFilters(c.Request.Context(), filters)
+	if errors.Is(err, errInvalidFilters) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		observability.Logger.Warn("Analytics query timed out",
+			zap.Int("ad_id", filters.AdID))
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": "Analytics query timed out",
+		})
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// Client went away; nobody is left to read a response
+		c.Status(config.StatusClientClosedRequest)
+		return
+	}
 	if err != nil {
 		observability.Logger.Error("Failed to fetch ad analytics",
 			zap.Error(err),
@@ -60,25 +91,77 @@ func (h *Handler) GetAdAnalytics(c *gin.Context) {
 
 	// Build response with metadata
 	response := &AnalyticsResponse{
-		Data:       results,
-		Total:      len(results),
+		Data:       page.Data,
+		Total:      page.Total,
+		Limit:      page.Limit,
+		Offset:     page.Offset,
+		HasMore:    page.HasMore,
+		NextCursor: page.NextCursor,
+		Comparison: page.Comparison,
 		Generated:  time.Now(),
 		IsRealTime: filters.RealTime,
 	}
 
 	// Log successful response
 	observability.Logger.Debug("Analytics request completed",
-		zap.Int("results_count", len(results)),
+		zap.Int("results_count", len(page.Data)),
 		zap.Bool("from_cache", response.IsRealTime))
 
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, error) {
+// GetVariantReport handles GET /ads/analytics/variants, comparing the CTR
+// of an ad's creative variants.
+func (h *Handler) GetVariantReport(c *gin.Context) {
+	filters, err := ParseFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var opts VariantOptions
+	if value := c.Query("confidence"); value != "" {
+		if opts.Confidence, err = strconv.ParseFloat(value, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid confidence"})
+			return
+		}
+	}
+	if value := c.Query("control_variant_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid control_variant_id"})
+			return
+		}
+		opts.ControlID = uint(id)
+	}
+
+	report, err := h.service.VariantReport(c.Request.Context(), filters, opts)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, report)
+	case errors.Is(err, errInvalidFilters):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errAdNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Analytics query timed out"})
+	case errors.Is(err, context.Canceled):
+		c.Status(config.StatusClientClosedRequest)
+	default:
+		observability.Logger.Error("Failed to compare ad variants",
+			zap.Error(err),
+			zap.Int("ad_id", filters.AdID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics data"})
+	}
+}
+
+// ParseFilters parses the analytics query parameters, as accepted by
+// GET /ads/analytics and stored in report definitions.
+func ParseFilters(query url.Values) (AnalyticsFilters, error) {
 	var filters AnalyticsFilters
 
 	// Parse ad_id (optional)
-	if adIDStr := c.Query("ad_id"); adIDStr != "" {
+	if adIDStr := query.Get("ad_id"); adIDStr != "" {
 		adID, err := strconv.Atoi(adIDStr)
 		if err != nil {
 			return filters, err
@@ -86,8 +169,25 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 		filters.AdID = adID
 	}
 
+	// Parse campaign_id and advertiser_id (optional)
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{
+		{"campaign_id", &filters.CampaignID},
+		{"advertiser_id", &filters.AdvertiserID},
+	} {
+		if value := query.Get(param.name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return filters, fmt.Errorf("invalid %s: %w", param.name, err)
+			}
+			*param.dest = id
+		}
+	}
+
 	// Parse pagination with defaults
-	limitStr := c.DefaultQuery("limit", "20")
+	limitStr := queryDefault(query, "limit", "20")
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
 		return filters, err
@@ -100,7 +200,7 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 	}
 	filters.Limit = limit
 
-	offsetStr := c.DefaultQuery("offset", "0")
+	offsetStr := queryDefault(query, "offset", "0")
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil {
 		return filters, err
@@ -111,7 +211,7 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 	filters.Offset = offset
 
 	// Parse time filters
-	if sinceStr := c.Query("since"); sinceStr != "" {
+	if sinceStr := query.Get("since"); sinceStr != "" {
 		since, err := time.Parse(time.RFC3339, sinceStr)
 		if err != nil {
 			return filters, err
@@ -119,7 +219,7 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 		filters.Since = since
 	}
 
-	if untilStr := c.Query("until"); untilStr != "" {
+	if untilStr := query.Get("until"); untilStr != "" {
 		until, err := time.Parse(time.RFC3339, untilStr)
 		if err != nil {
 			return filters, err
@@ -128,7 +228,7 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 	}
 
 	// Parse time_window (e.g., "1h", "30m", "24h")
-	if timeWindowStr := c.Query("time_window"); timeWindowStr != "" {
+	if timeWindowStr := query.Get("time_window"); timeWindowStr != "" {
 		timeWindow, err := time.ParseDuration(timeWindowStr)
 		if err != nil {
 			return filters, err
@@ -136,9 +236,89 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 		filters.TimeWindow = timeWindow
 	}
 
+	// Parse dimensional breakdown, e.g. group_by=device,country
+	if groupByStr := query.Get("group_by"); groupByStr != "" {
+		seen := make(map[string]bool)
+		for _, dimension := range strings.Split(groupByStr, ",") {
+			dimension = strings.ToLower(strings.TrimSpace(dimension))
+			if _, ok := analyticsDimensions[dimension]; !ok {
+				return filters, fmt.Errorf("unsupported group_by dimension %q", dimension)
+			}
+			if !seen[dimension] {
+				seen[dimension] = true
+				filters.GroupBy = append(filters.GroupBy, dimension)
+			}
+		}
+	}
+
+	// Parse rollup level, e.g. roll_up=campaign
+	filters.RollUp = strings.ToLower(query.Get("roll_up"))
+	if _, ok := rollUpColumns[filters.RollUp]; filters.RollUp != "" && !ok {
+		return filters, fmt.Errorf("unsupported roll_up %q", filters.RollUp)
+	}
+
+	// Parse dimension filters
+	filters.DeviceType = strings.ToLower(query.Get("device"))
+	filters.Browser = strings.ToLower(query.Get("browser"))
+	filters.OS = strings.ToLower(query.Get("os"))
+	filters.Country = strings.ToUpper(query.Get("country"))
+	filters.Region = strings.ToUpper(query.Get("region"))
+
+	// Parse unique-user identity strategy (ip, fingerprint, visitor)
+	filters.Identity = strings.ToLower(queryDefault(query, "identity", IdentityIP))
+	if _, ok := uniqueIdentityExprs[filters.Identity]; !ok {
+		return filters, fmt.Errorf("unsupported identity %q", filters.Identity)
+	}
+
+	// Parse sort, e.g. sort=ctr or sort=last_updated:asc (default descending)
+	if sortStr := query.Get("sort"); sortStr != "" {
+		field, direction, _ := strings.Cut(strings.ToLower(sortStr), ":")
+		if !sortFields[field] {
+			return filters, fmt.Errorf("unsupported sort field %q", field)
+		}
+		switch direction {
+		case "", "desc":
+		case "asc":
+			filters.SortAsc = true
+		default:
+			return filters, fmt.Errorf("unsupported sort direction %q", direction)
+		}
+		filters.Sort = field
+	}
+
+	// Parse period comparison: a relative mode, or an explicit range
+	filters.Compare = strings.ToLower(query.Get("compare"))
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{
+		{"compare_since", &filters.CompareSince},
+		{"compare_until", &filters.CompareUntil},
+	} {
+		if value := query.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filters, fmt.Errorf("invalid %s: %w", param.name, err)
+			}
+			*param.dest = t
+		}
+	}
+	if !filters.CompareSince.IsZero() || !filters.CompareUntil.IsZero() {
+		if filters.Compare != "" && filters.Compare != CompareCustom {
+			return filters, fmt.Errorf("compare=%s cannot be combined with compare_since/compare_until", filters.Compare)
+		}
+		filters.Compare = CompareCustom
+	}
+
+	// Parse opaque cursor returned as next_cursor by a previous page
+	filters.Cursor = query.Get("cursor")
+
 	// Parse boolean flags
-	filters.RealTime = c.DefaultQuery("real_time", "false") == "true"
-	filters.IncludeCTR = c.DefaultQuery("include_ctr", "false") == "true"
+	filters.RealTime = queryDefault(query, "real_time", "false") == "true"
+	filters.IncludeCTR = queryDefault(query, "include_ctr", "false") == "true"
+	filters.Approximate = queryDefault(query, "exact", "true") == "false"
+	filters.IncludeDistribution = queryDefault(query, "include_distribution", "false") == "true"
+	filters.IncludeFraud = queryDefault(query, "include_fraud", "false") == "true"
 
 	// If no time specified, default to last 24 hours
 	if filters.Since.IsZero() && filters.Until.IsZero() && filters.TimeWindow == 0 {
@@ -147,3 +327,93 @@ func (h *Handler) parseAnalyticsQueryParams(c *gin.Context) (AnalyticsFilters, e
 
 	return filters, nil
 }
+
+// queryDefault returns the value of key, or fallback if it is absent.
+func queryDefault(query url.Values, key, fallback string) string {
+	if value := query.Get(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// exportFunc streams the rows for filters to w; see Service.ExportAnalytics.
+type exportFunc func(ctx context.Context, filters AnalyticsFilters, format string, w io.Writer, flush func()) (int64, error)
+
+// ExportAnalytics handles GET /ads/analytics/export, streaming all analytics
+// rows matching the usual filters as CSV, NDJSON or Parquet.
+func (h *Handler) ExportAnalytics(c *gin.Context) {
+	h.export(c, "ad-analytics", h.service.ExportAnalytics)
+}
+
+// ExportClicks handles GET /ads/clicks/export, streaming the raw clicks
+// matching the ad, time range and dimension filters.
+func (h *Handler) ExportClicks(c *gin.Context) {
+	h.export(c, "ad-clicks", h.service.ExportClicks)
+}
+
+func (h *Handler) export(c *gin.Context, name string, run exportFunc) {
+	format := strings.ToLower(c.DefaultQuery("format", FormatCSV))
+	if !ValidExportFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", format)})
+		return
+	}
+
+	filters, err := ParseFilters(c.Request.URL.Query())
+	if err == nil {
+		// Resolve the range up front; it names the file
+		filters.Cursor = ""
+		err = h.service.prepareFilters(&filters)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("%s_%s_%s.%s", name,
+		filters.Since.UTC().Format("20060102T150405Z"),
+		filters.Until.UTC().Format("20060102T150405Z"),
+		format)
+	c.Header("Content-Type", ExportContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Accel-Buffering", "no") // Stream through proxies
+
+	// No Content-Length is set, so flushed batches go out chunked
+	start := time.Now()
+	rows, err := run(c.Request.Context(), filters, format, c.Writer, c.Writer.Flush)
+	if err != nil {
+		observability.Logger.Error("Export failed",
+			zap.Error(err),
+			zap.String("export", name),
+			zap.String("format", format),
+			zap.Int64("rows_written", rows))
+
+		// Once rows were sent the status is out. Dropping the connection
+		// before the final chunk makes the client see a failed download
+		// rather than a silently truncated file.
+		if c.Writer.Written() {
+			c.Abort()
+			if conn, _, err := c.Writer.Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		c.Writer.Header().Del("Content-Disposition")
+		switch {
+		case errors.Is(err, errInvalidFilters):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, context.DeadlineExceeded):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Export timed out"})
+		case errors.Is(err, context.Canceled):
+			c.Status(config.StatusClientClosedRequest)
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		}
+		return
+	}
+
+	observability.Logger.Info("Export completed",
+		zap.String("export", name),
+		zap.String("format", format),
+		zap.Int64("rows", rows),
+		zap.Duration("duration", time.Since(start)))
+}
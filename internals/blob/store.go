@@ -0,0 +1,22 @@
+// Package blob stores generated files such as report results.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no object exists under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a flat key/value store for large objects. Keys are slash
+// separated paths chosen by the caller.
+type Store interface {
+	// Write stores the bytes written by write under key. The object only
+	// becomes visible if write returns nil; on error nothing is stored.
+	Write(ctx context.Context, key string, write func(w io.Writer) error) (size int64, err error)
+	// Open returns the object stored under key and its size.
+	Open(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, key string) error
+}
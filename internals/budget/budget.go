@@ -0,0 +1,57 @@
+// Package budget prices clicks and impressions, records ad spend and
+// keeps ads within their budgets by pacing and pausing them.
+package budget
+
+import (
+	"time"
+)
+
+// Pricing models of models.Ad.PricingModel.
+const (
+	PricingCPC = "cpc" // Bid per click
+	PricingCPM = "cpm" // Bid per thousand impressions
+)
+
+func validPricingModel(model string) bool {
+	return model == PricingCPC || model == PricingCPM
+}
+
+// Reasons an ad is paused automatically, stored in models.Ad.PausedReason.
+const (
+	ReasonDailyBudget            = "daily_budget"
+	ReasonLifetimeBudget         = "lifetime_budget"
+	ReasonCampaignDailyBudget    = "campaign_daily_budget"
+	ReasonCampaignLifetimeBudget = "campaign_lifetime_budget"
+)
+
+// dailyReasons are lifted at the start of the next day.
+var dailyReasons = []string{ReasonDailyBudget, ReasonCampaignDailyBudget}
+
+// pacingLead is how far ahead of an even pace over the day spend may run
+// before an ad is held back, so that it is not starved by small bursts.
+const pacingLead = time.Hour
+
+// spendDay returns the start of the UTC day t falls in; daily budgets and
+// ad_spends rows are per UTC day.
+func spendDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// paceTarget returns how much of a daily budget may be spent by now when
+// spending it evenly across the day, plus pacingLead.
+func paceTarget(daily float64, now time.Time) float64 {
+	elapsed := now.Sub(spendDay(now)) + pacingLead
+	return daily * min(1, elapsed.Hours()/24)
+}
+
+// exhausted returns the reason a budget pair is spent, or "" if neither is.
+// Lifetime budgets take precedence since they are not lifted overnight.
+func exhausted(dailyBudget, lifetimeBudget, dailySpend, lifetimeSpend float64, daily, lifetime string) string {
+	switch {
+	case lifetimeBudget > 0 && lifetimeSpend >= lifetimeBudget:
+		return lifetime
+	case dailyBudget > 0 && dailySpend >= dailyBudget:
+		return daily
+	}
+	return ""
+}
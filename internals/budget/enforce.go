@@ -0,0 +1,130 @@
+package budget
+
+import (
+	"context"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// budgetSpend is a budget pair with the spend counted against it.
+type budgetSpend struct {
+	ID             uint
+	CampaignID     *uint
+	DailyBudget    float64
+	LifetimeBudget float64
+	DailySpend     float64
+	LifetimeSpend  float64
+}
+
+// enforce pauses the given ads, and every active ad of their campaigns,
+// once a budget they count against is spent.
+func (l *Ledger) enforce(ctx context.Context, adIDs []uint) error {
+	if len(adIDs) == 0 {
+		return nil
+	}
+	today := spendDay(time.Now())
+
+	var ads []budgetSpend
+	err := l.db.WithContext(ctx).
+		Table("ads").
+		Select(`ads.id, ads.campaign_id, ads.daily_budget, ads.lifetime_budget,
+			COALESCE(SUM(s.spend) FILTER (WHERE s.day = ?), 0) as daily_spend,
+			COALESCE(SUM(s.spend), 0) as lifetime_spend`, today).
+		Joins("LEFT JOIN ad_spends s ON s.ad_id = ads.id").
+		Where("ads.id IN ? AND ads.status = ?", adIDs, "active").
+		Group("ads.id").
+		Scan(&ads).Error
+	if err != nil {
+		return err
+	}
+
+	paused := make(map[string][]uint)
+	var campaignIDs []uint
+	for _, ad := range ads {
+		if reason := exhausted(ad.DailyBudget, ad.LifetimeBudget, ad.DailySpend, ad.LifetimeSpend,
+			ReasonDailyBudget, ReasonLifetimeBudget); reason != "" {
+			paused[reason] = append(paused[reason], ad.ID)
+		}
+		if ad.CampaignID != nil {
+			campaignIDs = append(campaignIDs, *ad.CampaignID)
+		}
+	}
+	for reason, ids := range paused {
+		if err := l.pause(ctx, reason, "id IN ?", ids); err != nil {
+			return err
+		}
+	}
+	if len(campaignIDs) == 0 {
+		return nil
+	}
+
+	var campaigns []budgetSpend
+	err = l.db.WithContext(ctx).
+		Table("campaigns").
+		Select(`campaigns.id, campaigns.daily_budget, campaigns.budget as lifetime_budget,
+			COALESCE(SUM(s.spend) FILTER (WHERE s.day = ?), 0) as daily_spend,
+			COALESCE(SUM(s.spend), 0) as lifetime_spend`, today).
+		Joins("LEFT JOIN ad_spends s ON s.campaign_id = campaigns.id").
+		Where("campaigns.id IN ?", campaignIDs).
+		Group("campaigns.id").
+		Scan(&campaigns).Error
+	if err != nil {
+		return err
+	}
+
+	for _, campaign := range campaigns {
+		reason := exhausted(campaign.DailyBudget, campaign.LifetimeBudget, campaign.DailySpend, campaign.LifetimeSpend,
+			ReasonCampaignDailyBudget, ReasonCampaignLifetimeBudget)
+		if reason == "" {
+			continue
+		}
+		if err := l.pause(ctx, reason, "campaign_id = ?", campaign.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pause pauses the active ads matching the condition for reason.
+func (l *Ledger) pause(ctx context.Context, reason string, query string, args ...interface{}) error {
+	result := l.db.WithContext(ctx).
+		Model(&models.Ad{}).
+		Where(query, args...).
+		Where("status = ?", "active").
+		Updates(map[string]interface{}{"status": "paused", "paused_reason": reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		observability.AdsBudgetPaused.WithLabelValues(reason).Add(float64(result.RowsAffected))
+		observability.Logger.Info("Paused ads on spent budget",
+			zap.String("reason", reason),
+			zap.Int64("ads", result.RowsAffected))
+	}
+	return nil
+}
+
+// resumeDaily reactivates the ads paused for a daily budget, then pauses
+// those of them whose lifetime budget is spent after all.
+func (l *Ledger) resumeDaily(ctx context.Context) error {
+	var resumed []models.Ad
+	err := l.db.WithContext(ctx).
+		Model(&resumed).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("status = ? AND paused_reason IN ?", "paused", dailyReasons).
+		Updates(map[string]interface{}{"status": "active", "paused_reason": ""}).Error
+	if err != nil || len(resumed) == 0 {
+		return err
+	}
+
+	observability.Logger.Info("Resumed ads paused for daily budgets", zap.Int("ads", len(resumed)))
+	adIDs := make([]uint, len(resumed))
+	for i, ad := range resumed {
+		adIDs[i] = ad.ID
+	}
+	return l.enforce(ctx, adIDs)
+}
@@ -0,0 +1,220 @@
+package budget
+
+import (
+	"context"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/snapshot"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// priceRefreshInterval is how long ad prices are reused before reloading.
+const priceRefreshInterval = 30 * time.Second
+
+type spendKey struct {
+	adID uint
+	day  time.Time
+}
+
+type pendingSpend struct {
+	campaignID *uint
+	spend      float64
+}
+
+// adPrice is what an ad is charged for its billable events.
+type adPrice struct {
+	campaignID *uint
+	model      string
+	bid        float64
+}
+
+// Ledger prices clicks and impressions as they are persisted, buffers the
+// spend per ad and day, and periodically adds it to ad_spends. After each
+// flush the budgets of the ads that spent are checked and ads whose
+// budget, or whose campaign's budget, is spent are paused. Ads paused for
+// a daily budget are resumed when the next day starts.
+type Ledger struct {
+	db         *gorm.DB
+	flushEvery time.Duration
+
+	mu      sync.Mutex
+	pending map[spendKey]*pendingSpend
+
+	prices *snapshot.Value[map[uint]adPrice]
+
+	day time.Time // Day daily pauses were last lifted for
+}
+
+func NewLedger(db *gorm.DB, flushEvery time.Duration) *Ledger {
+	l := &Ledger{db: db, flushEvery: flushEvery, pending: make(map[spendKey]*pendingSpend)}
+	l.prices = snapshot.New("ad prices", priceRefreshInterval, l.loadPrices)
+	return l
+}
+
+// RecordClick charges a persisted click to its ad if the ad is priced per
+// click.
+func (l *Ledger) RecordClick(ctx context.Context, adID uint, at time.Time) {
+	l.record(ctx, adID, at, PricingCPC)
+}
+
+// RecordImpression charges a persisted impression to its ad if the ad is
+// priced per thousand impressions.
+func (l *Ledger) RecordImpression(ctx context.Context, adID uint, at time.Time) {
+	l.record(ctx, adID, at, PricingCPM)
+}
+
+func (l *Ledger) record(ctx context.Context, adID uint, at time.Time, model string) {
+	price, ok := l.price(ctx, adID)
+	if !ok || price.model != model {
+		return
+	}
+	cost := price.bid
+	if model == PricingCPM {
+		cost /= 1000
+	}
+	observability.AdSpend.WithLabelValues(model).Add(cost)
+
+	key := spendKey{adID: adID, day: spendDay(at)}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.pending[key]
+	if !ok {
+		p = &pendingSpend{}
+		l.pending[key] = p
+	}
+	p.campaignID = price.campaignID
+	p.spend += cost
+}
+
+// price returns the pricing of a billable ad. Prices are reloaded in the
+// background once they are older than priceRefreshInterval; if a reload
+// fails the previous prices are kept.
+func (l *Ledger) price(ctx context.Context, adID uint) (adPrice, bool) {
+	prices, err := l.prices.Get(ctx)
+	if err != nil {
+		return adPrice{}, false
+	}
+	price, ok := prices[adID]
+	return price, ok
+}
+
+// loadPrices reads the pricing of ads with a bid. Ads with an unknown
+// pricing model are left out, so they are not charged.
+func (l *Ledger) loadPrices(ctx context.Context) (map[uint]adPrice, error) {
+	var ads []models.Ad
+	err := l.db.WithContext(ctx).
+		Select("id", "campaign_id", "pricing_model", "bid").
+		Where("bid > 0").
+		Find(&ads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[uint]adPrice, len(ads))
+	for _, ad := range ads {
+		if !validPricingModel(ad.PricingModel) {
+			observability.Logger.Warn("Ignoring ad with unknown pricing model",
+				zap.Uint("ad_id", ad.ID),
+				zap.String("pricing_model", ad.PricingModel))
+			continue
+		}
+		prices[ad.ID] = adPrice{campaignID: ad.CampaignID, model: ad.PricingModel, bid: ad.Bid}
+	}
+	return prices, nil
+}
+
+// Run flushes buffered spend on a fixed interval until ctx is done, lifting
+// daily pauses whenever a new day has started.
+func (l *Ledger) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.flushEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.flush()
+			return
+		case <-ticker.C:
+			l.flush()
+			l.startDay()
+		}
+	}
+}
+
+func (l *Ledger) flush() {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = make(map[spendKey]*pendingSpend)
+	l.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	rows := make([]models.AdSpend, 0, len(pending))
+	adIDs := make([]uint, 0, len(pending))
+	for key, p := range pending {
+		rows = append(rows, models.AdSpend{AdID: key.adID, Day: key.day, CampaignID: p.campaignID, Spend: p.spend})
+		adIDs = append(adIDs, key.adID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := l.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "ad_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"spend":       gorm.Expr("ad_spends.spend + EXCLUDED.spend"),
+			"campaign_id": gorm.Expr("EXCLUDED.campaign_id"),
+			"updated_at":  gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		// Keep the spend for the next flush rather than losing it
+		observability.Logger.Error("Failed to flush ad spend",
+			zap.Error(err),
+			zap.Int("rows", len(rows)))
+		l.restore(pending)
+		return
+	}
+
+	if err := l.enforce(ctx, adIDs); err != nil {
+		observability.Logger.Error("Failed to enforce ad budgets", zap.Error(err))
+	}
+}
+
+// restore merges spend that failed to flush back into the buffer.
+func (l *Ledger) restore(pending map[spendKey]*pendingSpend) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, p := range pending {
+		if current, ok := l.pending[key]; ok {
+			current.spend += p.spend
+		} else {
+			l.pending[key] = p
+		}
+	}
+}
+
+// startDay resumes the ads paused for a daily budget once per day, on the
+// first tick of each process as well so a restart catches up.
+func (l *Ledger) startDay() {
+	today := spendDay(time.Now())
+	if l.day.Equal(today) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := l.resumeDaily(ctx); err != nil {
+		observability.Logger.Error("Failed to resume ads paused for daily budgets", zap.Error(err))
+		return
+	}
+	l.day = today
+}
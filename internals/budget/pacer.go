@@ -0,0 +1,115 @@
+package budget
+
+import (
+	"context"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/snapshot"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Pacer holds ads back while today's spend of their daily budget, or of
+// their campaign's, is ahead of an even pace across the day. It works from
+// a snapshot of today's spend that is reloaded in the background at most
+// every refreshEvery, so spend flushed since then is not yet seen.
+type Pacer struct {
+	db    *gorm.DB
+	spend *snapshot.Value[*daySpend]
+}
+
+// daySpend is the spend of one day, as loaded for pacing.
+type daySpend struct {
+	day             time.Time
+	adSpend         map[uint]float64
+	campaignSpend   map[uint]float64
+	campaignBudgets map[uint]float64 // Daily budgets of campaigns that have one
+}
+
+func NewPacer(db *gorm.DB, refreshEvery time.Duration) *Pacer {
+	p := &Pacer{db: db}
+	p.spend = snapshot.New("daily spend", refreshEvery, p.load)
+	return p
+}
+
+// Allow reports whether ad may be served at now. If spend cannot be loaded
+// ads are served unpaced, as they are from the start of a day until its
+// spend has been loaded.
+func (p *Pacer) Allow(ctx context.Context, ad *models.Ad, now time.Time) bool {
+	spend, err := p.spend.Get(ctx)
+	if err != nil {
+		return true
+	}
+	if !spend.day.Equal(spendDay(now)) {
+		p.spend.Refresh()
+		return true
+	}
+
+	if ad.DailyBudget > 0 && spend.adSpend[ad.ID] >= paceTarget(ad.DailyBudget, now) {
+		return false
+	}
+	if ad.CampaignID != nil {
+		if daily := spend.campaignBudgets[*ad.CampaignID]; daily > 0 && spend.campaignSpend[*ad.CampaignID] >= paceTarget(daily, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// load reads today's spend per ad and campaign, and campaign daily budgets.
+func (p *Pacer) load(ctx context.Context) (*daySpend, error) {
+	today := spendDay(time.Now())
+
+	var ads []struct {
+		AdID  uint
+		Spend float64
+	}
+	err := p.db.WithContext(ctx).
+		Model(&models.AdSpend{}).
+		Select("ad_id, spend").
+		Where("day = ?", today).
+		Scan(&ads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var campaigns []struct {
+		CampaignID uint
+		Spend      float64
+	}
+	err = p.db.WithContext(ctx).
+		Model(&models.AdSpend{}).
+		Select("campaign_id, SUM(spend) as spend").
+		Where("day = ? AND campaign_id IS NOT NULL", today).
+		Group("campaign_id").
+		Scan(&campaigns).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var budgets []models.Campaign
+	err = p.db.WithContext(ctx).
+		Select("id", "daily_budget").
+		Where("daily_budget > 0").
+		Find(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	spend := &daySpend{
+		day:             today,
+		adSpend:         make(map[uint]float64, len(ads)),
+		campaignSpend:   make(map[uint]float64, len(campaigns)),
+		campaignBudgets: make(map[uint]float64, len(budgets)),
+	}
+	for _, row := range ads {
+		spend.adSpend[row.AdID] = row.Spend
+	}
+	for _, row := range campaigns {
+		spend.campaignSpend[row.CampaignID] = row.Spend
+	}
+	for _, campaign := range budgets {
+		spend.campaignBudgets[campaign.ID] = campaign.DailyBudget
+	}
+	return spend, nil
+}
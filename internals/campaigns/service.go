@@ -0,0 +1,299 @@
+// Package campaigns manages advertisers and the campaigns that group
+// their ads.
+package campaigns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/flight"
+	"lystage-proj/internals/models"
+	"net/mail"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidRequest     = errors.New("invalid request")
+	errAdvertiserNotFound = errors.New("advertiser not found")
+	errCampaignNotFound   = errors.New("campaign not found")
+	errAdvertiserInUse    = errors.New("advertiser still has campaigns")
+	errAdNotInCampaign    = errors.New("ad not in campaign")
+)
+
+type Service struct {
+	DB *gorm.DB
+}
+
+func NewService() *Service {
+	return &Service{DB: db.GormDB}
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case StatusActive, StatusPaused, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// advertiserFromRequest validates req and applies it to advertiser.
+func advertiserFromRequest(req AdvertiserRequest, advertiser *models.Advertiser) error {
+	if req.Status == "" {
+		req.Status = StatusActive
+	}
+	if !validStatus(req.Status) {
+		return fmt.Errorf("unknown status %q", req.Status)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if req.ContactEmail != "" {
+		if _, err := mail.ParseAddress(req.ContactEmail); err != nil {
+			return fmt.Errorf("invalid contact_email")
+		}
+	}
+
+	advertiser.Name = strings.TrimSpace(req.Name)
+	advertiser.ContactEmail = req.ContactEmail
+	advertiser.Status = req.Status
+	return nil
+}
+
+func (s *Service) CreateAdvertiser(ctx context.Context, req AdvertiserRequest) (*models.Advertiser, error) {
+	advertiser := &models.Advertiser{}
+	if err := advertiserFromRequest(req, advertiser); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if err := s.DB.WithContext(ctx).Create(advertiser).Error; err != nil {
+		return nil, err
+	}
+	return advertiser, nil
+}
+
+func (s *Service) UpdateAdvertiser(ctx context.Context, id uint, req AdvertiserRequest) (*models.Advertiser, error) {
+	advertiser, err := s.GetAdvertiser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := advertiserFromRequest(req, advertiser); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if err := s.DB.WithContext(ctx).Save(advertiser).Error; err != nil {
+		return nil, err
+	}
+	return advertiser, nil
+}
+
+func (s *Service) GetAdvertiser(ctx context.Context, id uint) (*models.Advertiser, error) {
+	var advertiser models.Advertiser
+	err := s.DB.WithContext(ctx).First(&advertiser, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errAdvertiserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &advertiser, nil
+}
+
+func (s *Service) ListAdvertisers(ctx context.Context) ([]models.Advertiser, error) {
+	var advertisers []models.Advertiser
+	err := s.DB.WithContext(ctx).Order("name, id").Find(&advertisers).Error
+	return advertisers, err
+}
+
+// DeleteAdvertiser removes an advertiser that has no campaigns left;
+// campaigns must be deleted or moved first.
+func (s *Service) DeleteAdvertiser(ctx context.Context, id uint) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var campaigns int64
+		if err := tx.Model(&models.Campaign{}).Where("advertiser_id = ?", id).Count(&campaigns).Error; err != nil {
+			return err
+		}
+		if campaigns > 0 {
+			return errAdvertiserInUse
+		}
+
+		result := tx.Delete(&models.Advertiser{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAdvertiserNotFound
+		}
+		return nil
+	})
+}
+
+// campaignFromRequest validates req and applies it to campaign.
+func campaignFromRequest(req CampaignRequest, campaign *models.Campaign) error {
+	if req.Status == "" {
+		req.Status = StatusActive
+	}
+	if !validStatus(req.Status) {
+		return fmt.Errorf("unknown status %q", req.Status)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if req.StartAt != nil && req.EndAt != nil && !req.EndAt.After(*req.StartAt) {
+		return fmt.Errorf("end_at must be after start_at")
+	}
+	if _, err := flight.New(req.StartAt, req.EndAt, req.Schedule, req.Timezone); err != nil {
+		return err
+	}
+	if req.Budget < 0 || req.DailyBudget < 0 {
+		return fmt.Errorf("budgets must not be negative")
+	}
+
+	campaign.AdvertiserID = req.AdvertiserID
+	campaign.Name = strings.TrimSpace(req.Name)
+	campaign.Status = req.Status
+	campaign.StartAt = req.StartAt
+	campaign.EndAt = req.EndAt
+	campaign.Schedule = strings.TrimSpace(req.Schedule)
+	campaign.Timezone = req.Timezone
+	campaign.Budget = req.Budget
+	campaign.DailyBudget = req.DailyBudget
+	return nil
+}
+
+// checkAdvertiser rejects a campaign request naming an unknown advertiser.
+func (s *Service) checkAdvertiser(ctx context.Context, id uint) error {
+	_, err := s.GetAdvertiser(ctx, id)
+	if errors.Is(err, errAdvertiserNotFound) {
+		return fmt.Errorf("%w: advertiser %d does not exist", errInvalidRequest, id)
+	}
+	return err
+}
+
+func (s *Service) CreateCampaign(ctx context.Context, req CampaignRequest) (*models.Campaign, error) {
+	campaign := &models.Campaign{}
+	if err := campaignFromRequest(req, campaign); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if err := s.checkAdvertiser(ctx, req.AdvertiserID); err != nil {
+		return nil, err
+	}
+	if err := s.DB.WithContext(ctx).Create(campaign).Error; err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+func (s *Service) UpdateCampaign(ctx context.Context, id uint, req CampaignRequest) (*models.Campaign, error) {
+	campaign, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := campaignFromRequest(req, campaign); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if err := s.checkAdvertiser(ctx, req.AdvertiserID); err != nil {
+		return nil, err
+	}
+	if err := s.DB.WithContext(ctx).Save(campaign).Error; err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+func (s *Service) GetCampaign(ctx context.Context, id uint) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := s.DB.WithContext(ctx).First(&campaign, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errCampaignNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// ListCampaigns returns campaigns, optionally only those of one advertiser
+// (advertiserID > 0) or in one status.
+func (s *Service) ListCampaigns(ctx context.Context, advertiserID uint, status string) ([]models.Campaign, error) {
+	query := s.DB.WithContext(ctx).Order("created_at DESC, id DESC")
+	if advertiserID > 0 {
+		query = query.Where("advertiser_id = ?", advertiserID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var campaigns []models.Campaign
+	err := query.Find(&campaigns).Error
+	return campaigns, err
+}
+
+// DeleteCampaign removes a campaign. Its ads are kept and unassigned.
+func (s *Service) DeleteCampaign(ctx context.Context, id uint) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Ad{}).Where("campaign_id = ?", id).Update("campaign_id", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Campaign{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCampaignNotFound
+		}
+		return nil
+	})
+}
+
+// ListCampaignAds returns the ads in a campaign, newest first.
+func (s *Service) ListCampaignAds(ctx context.Context, id uint) ([]models.Ad, error) {
+	if _, err := s.GetCampaign(ctx, id); err != nil {
+		return nil, err
+	}
+
+	var ads []models.Ad
+	err := s.DB.WithContext(ctx).Where("campaign_id = ?", id).Order("created_at DESC").Find(&ads).Error
+	return ads, err
+}
+
+// AssignAds moves ads into a campaign, out of any campaign they were in.
+// Either all of adIDs are assigned or, if any does not exist, none are.
+func (s *Service) AssignAds(ctx context.Context, id uint, adIDs []uint) error {
+	if _, err := s.GetCampaign(ctx, id); err != nil {
+		return err
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Ad{}).Where("id IN ?", adIDs).Update("campaign_id", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if unique := countUnique(adIDs); result.RowsAffected != int64(unique) {
+			return fmt.Errorf("%w: %d of %d ads do not exist", errInvalidRequest, int64(unique)-result.RowsAffected, unique)
+		}
+		return nil
+	})
+}
+
+// UnassignAd removes an ad from a campaign.
+func (s *Service) UnassignAd(ctx context.Context, id, adID uint) error {
+	result := s.DB.WithContext(ctx).Model(&models.Ad{}).
+		Where("id = ? AND campaign_id = ?", adID, id).
+		Update("campaign_id", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errAdNotInCampaign
+	}
+	return nil
+}
+
+func countUnique(ids []uint) int {
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,39 @@
+package campaigns
+
+import "time"
+
+// Statuses shared by advertisers and campaigns.
+const (
+	StatusActive   = "active"
+	StatusPaused   = "paused"
+	StatusArchived = "archived"
+)
+
+// AdvertiserRequest creates or replaces an advertiser. Status defaults to
+// active.
+type AdvertiserRequest struct {
+	Name         string `json:"name" binding:"required"`
+	ContactEmail string `json:"contact_email"`
+	Status       string `json:"status"`
+}
+
+// CampaignRequest creates or replaces a campaign. Status defaults to
+// active and a zero budget is unlimited. Budget is the lifetime budget.
+// Schedule is a day-parting schedule such as "mon-fri 9-17; sat 10-14" in
+// Timezone.
+type CampaignRequest struct {
+	AdvertiserID uint       `json:"advertiser_id" binding:"required"`
+	Name         string     `json:"name" binding:"required"`
+	Status       string     `json:"status"`
+	StartAt      *time.Time `json:"start_at"`
+	EndAt        *time.Time `json:"end_at"`
+	Schedule     string     `json:"schedule"`
+	Timezone     string     `json:"timezone"`
+	Budget       float64    `json:"budget"`
+	DailyBudget  float64    `json:"daily_budget"`
+}
+
+// AssignAdsRequest moves ads into a campaign.
+type AssignAdsRequest struct {
+	AdIDs []uint `json:"ad_ids" binding:"required,min=1"`
+}
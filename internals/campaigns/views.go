@@ -0,0 +1,257 @@
+package campaigns
+
+import (
+	"errors"
+	"lystage-proj/internals/observability"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateAdvertiser handles POST /advertisers.
+func (h *Handler) CreateAdvertiser(c *gin.Context) {
+	var req AdvertiserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	advertiser, err := h.service.CreateAdvertiser(c.Request.Context(), req)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, advertiser)
+}
+
+// ListAdvertisers handles GET /advertisers.
+func (h *Handler) ListAdvertisers(c *gin.Context) {
+	advertisers, err := h.service.ListAdvertisers(c.Request.Context())
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": advertisers})
+}
+
+// GetAdvertiser handles GET /advertisers/:id.
+func (h *Handler) GetAdvertiser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	advertiser, err := h.service.GetAdvertiser(c.Request.Context(), id)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, advertiser)
+}
+
+// UpdateAdvertiser handles PUT /advertisers/:id.
+func (h *Handler) UpdateAdvertiser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req AdvertiserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	advertiser, err := h.service.UpdateAdvertiser(c.Request.Context(), id, req)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, advertiser)
+}
+
+// DeleteAdvertiser handles DELETE /advertisers/:id.
+func (h *Handler) DeleteAdvertiser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if !serviceError(c, h.service.DeleteAdvertiser(c.Request.Context(), id)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateCampaign handles POST /campaigns.
+func (h *Handler) CreateCampaign(c *gin.Context) {
+	var req CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	campaign, err := h.service.CreateCampaign(c.Request.Context(), req)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// ListCampaigns handles GET /campaigns, optionally filtered by
+// advertiser_id and status.
+func (h *Handler) ListCampaigns(c *gin.Context) {
+	var advertiserID uint
+	if raw := c.Query("advertiser_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 0)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "advertiser_id must be a positive integer"})
+			return
+		}
+		advertiserID = uint(id)
+	}
+	status := c.Query("status")
+	if status != "" && !validStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, paused or archived"})
+		return
+	}
+
+	campaigns, err := h.service.ListCampaigns(c.Request.Context(), advertiserID, status)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": campaigns})
+}
+
+// GetCampaign handles GET /campaigns/:id.
+func (h *Handler) GetCampaign(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	campaign, err := h.service.GetCampaign(c.Request.Context(), id)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+// UpdateCampaign handles PUT /campaigns/:id.
+func (h *Handler) UpdateCampaign(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	campaign, err := h.service.UpdateCampaign(c.Request.Context(), id, req)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign handles DELETE /campaigns/:id. The campaign's ads are
+// kept and unassigned.
+func (h *Handler) DeleteCampaign(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if !serviceError(c, h.service.DeleteCampaign(c.Request.Context(), id)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListCampaignAds handles GET /campaigns/:id/ads.
+func (h *Handler) ListCampaignAds(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	ads, err := h.service.ListCampaignAds(c.Request.Context(), id)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": ads})
+}
+
+// AssignAds handles POST /campaigns/:id/ads, moving the ads in the body's
+// ad_ids into the campaign.
+func (h *Handler) AssignAds(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req AssignAdsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if !serviceError(c, h.service.AssignAds(c.Request.Context(), id, req.AdIDs)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UnassignAd handles DELETE /campaigns/:id/ads/:ad_id.
+func (h *Handler) UnassignAd(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	adID, ok := parseID(c, "ad_id")
+	if !ok {
+		return
+	}
+
+	if !serviceError(c, h.service.UnassignAd(c.Request.Context(), id, adID)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// serviceError writes the response for a service error and reports whether
+// the handler may continue.
+func serviceError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errInvalidRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errAdvertiserNotFound), errors.Is(err, errCampaignNotFound), errors.Is(err, errAdNotInCampaign):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errAdvertiserInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		observability.Logger.Error("Campaign request failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+	}
+	return false
+}
+
+func parseID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 0)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,221 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lystage-proj/internals/ads"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/tracking"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// utmParams are passed from the tracking link through to the landing page.
+var utmParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// errUnsafeTarget is returned when an expanded target URL would send the
+// viewer somewhere other than the ad's own landing page.
+var errUnsafeTarget = errors.New("unsafe redirect target")
+
+// RedirectHandler serves click tracking links: it records the click and
+// sends the viewer on to the ad's landing page.
+type RedirectHandler struct {
+	service      Service
+	signer       *tracking.Signer
+	ads          *ads.AdService
+	allowedHosts []string
+}
+
+// NewRedirectHandler creates the tracking link handler. Landing pages must
+// be on one of allowedHosts (a leading "." also allows subdomains); with
+// none, any http(s) host set on the ad is allowed.
+func NewRedirectHandler(service Service, signer *tracking.Signer, adService *ads.AdService, allowedHosts []string) *RedirectHandler {
+	return &RedirectHandler{service: service, signer: signer, ads: adService, allowedHosts: allowedHosts}
+}
+
+// HandleRedirect handles GET /c/:token. Expired or already used tokens
+// still redirect, since the viewer did click, but are not counted.
+func (h *RedirectHandler) HandleRedirect(c *gin.Context) {
+	raw := c.Param("token")
+	token, err := h.signer.Verify(raw)
+	if errors.Is(err, tracking.ErrInvalidToken) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown tracking link"})
+		return
+	}
+
+	ad, err := h.ads.GetAd(c.Request.Context(), token.AdID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		observability.Logger.Error("Failed to load ad for click redirect",
+			zap.Error(err),
+			zap.Uint("ad_id", token.AdID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process click"})
+		return
+	}
+
+	req := ClickRequestData{
+		AdID:      token.AdID,
+		Token:     raw,
+		UserIP:    c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Timestamp: time.Now().Unix(),
+		EventID:   uuid.New(),
+	}
+	if cookie, err := c.Cookie(visitorIDCookie); err == nil && len(cookie) <= maxVisitorIDLength {
+		req.VisitorID = cookie
+	}
+
+	counted := false
+	switch err := h.service.RecordClick(c.Request.Context(), req); {
+	case err == nil:
+		counted = true
+	case errors.Is(err, tracking.ErrExpiredToken), errors.Is(err, tracking.ErrReplayedToken), errors.Is(err, ErrOutOfFlight):
+		observability.Logger.Debug("Redirecting without counting click",
+			zap.Error(err),
+			zap.Uint("ad_id", token.AdID))
+	case errors.Is(err, context.Canceled):
+		return
+	default:
+		// The viewer still reaches the landing page
+		observability.Logger.Error("Failed to record redirect click",
+			zap.Error(err),
+			zap.Uint("ad_id", token.AdID))
+	}
+
+	macros := map[string]string{
+		"ad_id":         strconv.FormatUint(uint64(token.AdID), 10),
+		"variant_id":    "",
+		"impression_id": token.ImpressionID.String(),
+		"timestamp":     strconv.FormatInt(req.Timestamp, 10),
+		"click_id":      "",
+	}
+	if counted {
+		macros["click_id"] = req.EventID.String()
+	}
+	if token.VariantID != 0 {
+		macros["variant_id"] = strconv.FormatUint(uint64(token.VariantID), 10)
+	}
+	query := c.Request.URL.Query()
+	for _, param := range utmParams {
+		macros[param] = query.Get(param)
+	}
+
+	targetURL := h.landingPage(c.Request.Context(), ad, token.VariantID)
+	target, err := expandTarget(targetURL, macros, query, h.allowedHosts)
+	if err != nil {
+		observability.Logger.Warn("Refusing to redirect to ad target",
+			zap.Error(err),
+			zap.Uint("ad_id", ad.ID),
+			zap.String("target_url", targetURL))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Ad has no valid landing page"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer-when-downgrade")
+	c.Redirect(http.StatusFound, target)
+}
+
+// landingPage returns the target URL of the variant the token was issued
+// for, if it overrides the ad's, and the ad's otherwise. A variant that
+// cannot be loaded, e.g. deleted since, falls back to the ad's.
+func (h *RedirectHandler) landingPage(ctx context.Context, ad *models.Ad, variantID uint) string {
+	if variantID == 0 {
+		return ad.TargetURL
+	}
+	variant, err := h.ads.GetVariant(ctx, ad.ID, variantID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			observability.Logger.Warn("Failed to load variant for click redirect",
+				zap.Error(err),
+				zap.Uint("ad_id", ad.ID),
+				zap.Uint("variant_id", variantID))
+		}
+		return ad.TargetURL
+	}
+	if variant.TargetURL != "" {
+		return variant.TargetURL
+	}
+	return ad.TargetURL
+}
+
+// expandTarget substitutes {macro} placeholders in an ad's target URL and
+// carries the link's UTM parameters over unless the target sets them.
+// Macro values are query-escaped, and the result must be an absolute
+// http(s) URL on the template's own host, which must be allowed.
+func expandTarget(template string, macros map[string]string, query url.Values, allowedHosts []string) (string, error) {
+	base, err := url.Parse(template)
+	if err != nil {
+		return "", err
+	}
+
+	pairs := make([]string, 0, len(macros)*2)
+	for name, value := range macros {
+		pairs = append(pairs, "{"+name+"}", url.QueryEscape(value))
+	}
+	expanded, err := url.Parse(strings.NewReplacer(pairs...).Replace(template))
+	if err != nil {
+		return "", err
+	}
+
+	if expanded.Scheme != "http" && expanded.Scheme != "https" {
+		return "", fmt.Errorf("%w: scheme %q", errUnsafeTarget, expanded.Scheme)
+	}
+	if expanded.User != nil {
+		return "", fmt.Errorf("%w: userinfo", errUnsafeTarget)
+	}
+	host := expanded.Hostname()
+	if host == "" || !strings.EqualFold(host, base.Hostname()) {
+		return "", fmt.Errorf("%w: host %q", errUnsafeTarget, expanded.Host)
+	}
+	if !hostAllowed(host, allowedHosts) {
+		return "", fmt.Errorf("%w: host %q not allowed", errUnsafeTarget, host)
+	}
+
+	targetQuery := expanded.Query()
+	changed := false
+	for _, param := range utmParams {
+		if value := query.Get(param); value != "" && !targetQuery.Has(param) {
+			targetQuery.Set(param, value)
+			changed = true
+		}
+	}
+	if changed {
+		expanded.RawQuery = targetQuery.Encode()
+	}
+	return expanded.String(), nil
+}
+
+func hostAllowed(host string, allowedHosts []string) bool {
+	if len(allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "."); ok {
+			if host == suffix || strings.HasSuffix(host, allowed) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -2,9 +2,14 @@ package clicks
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"lystage-proj/internals/flight"
 	"lystage-proj/internals/observability"
 	"lystage-proj/internals/queue"
+	"lystage-proj/internals/tracking"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,39 +17,141 @@ import (
 )
 
 type Service interface {
-	RecordClick(data ClickRequestData) error
+	RecordClick(ctx context.Context, data ClickRequestData) error
 }
 
-type clickService struct{}
+// ErrMissingToken is returned when clicks must be signed and no token was
+// sent.
+var ErrMissingToken = errors.New("click token required")
 
-func NewService() Service {
-	return &clickService{}
+// ErrOutOfFlight is returned for clicks on an ad outside its flight when
+// such clicks are rejected.
+var ErrOutOfFlight = errors.New("ad is not in flight")
+
+type clickService struct {
+	visitorSalt string
+	signer      *tracking.Signer
+	replay      tracking.ReplayGuard
+	flights     *flight.Checker
+}
+
+// NewService creates the click service. visitorSalt keys the server-derived
+// visitor fingerprint and must be shared by all replicas. With a signer,
+// every click must carry a token issued for its ad, and replay rejects
+// tokens already used; a nil signer accepts unsigned clicks. With flights,
+// unsigned clicks outside their ad's flight are rejected; otherwise they
+// are left to the fraud rules to flag.
+func NewService(visitorSalt string, signer *tracking.Signer, replay tracking.ReplayGuard, flights *flight.Checker) Service {
+	return &clickService{visitorSalt: visitorSalt, signer: signer, replay: replay, flights: flights}
+}
+
+// verifyToken checks the click's token and links the click to the
+// impression it was issued for. It returns the token if it was claimed,
+// so the claim can be released if the click is not recorded.
+func (s *clickService) verifyToken(ctx context.Context, data *ClickRequestData) (*tracking.Token, error) {
+	if data.Token == "" {
+		return nil, ErrMissingToken
+	}
+	token, err := s.signer.Verify(data.Token)
+	if err != nil {
+		return nil, err
+	}
+	if token.AdID != data.AdID {
+		return nil, tracking.ErrInvalidToken
+	}
+
+	// A failing store should not drop real clicks; tokens still expire
+	var claimed *tracking.Token
+	first, err := s.replay.Claim(ctx, token)
+	if err != nil {
+		observability.Logger.Warn("Click token replay check failed, accepting click",
+			zap.Error(err),
+			zap.String("impression_id", token.ImpressionID.String()))
+	} else if !first {
+		return nil, tracking.ErrReplayedToken
+	} else {
+		claimed = &token
+	}
+
+	data.ImpressionID = &token.ImpressionID
+	data.VariantID = nil
+	if token.VariantID != 0 {
+		data.VariantID = &token.VariantID
+	}
+	return claimed, nil
+}
+
+// release forgets a claimed token whose click could not be published, so
+// the client can send the click again.
+func (s *clickService) release(ctx context.Context, token *tracking.Token) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.replay.Release(ctx, *token); err != nil {
+		observability.Logger.Warn("Failed to release click token",
+			zap.Error(err),
+			zap.String("impression_id", token.ImpressionID.String()))
+	}
+}
+
+// fingerprint derives a stable pseudonymous visitor id from IP and user
+// agent. Salting keeps raw IPs from being recoverable by brute force.
+func (s *clickService) fingerprint(ip, userAgent string) string {
+	mac := hmac.New(sha256.New, []byte(s.visitorSalt))
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
-func (s *clickService) RecordClick(data ClickRequestData) error {
+// RecordClick validates a click and queues it for Kafka. Publishing happens
+// after the request returns, so it keeps ctx's values but not its
+// cancellation.
+func (s *clickService) RecordClick(ctx context.Context, data ClickRequestData) error {
 	if data.AdID == 0 {
 		return errors.New("invalid ad_id")
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data.ImpressionID, data.VariantID = nil, nil
+	var claimed *tracking.Token
+	if s.signer != nil {
+		var err error
+		if claimed, err = s.verifyToken(ctx, &data); err != nil {
+			return err
+		}
+	}
+	// Clicks through a token are on an impression served in flight
+	if s.flights != nil && data.ImpressionID == nil && !s.flights.InFlight(data.AdID, time.Now()) {
+		return ErrOutOfFlight
+	}
 	if data.EventID == uuid.Nil {
 		data.EventID = uuid.New()
 	}
+	data.Fingerprint = s.fingerprint(data.UserIP, data.UserAgent)
 
 	event := queue.ClickEvent{
-		EventID:   data.EventID,
-		AdID:      data.AdID,
-		UserIP:    data.UserIP,
-		Agent:     data.UserAgent,
-		Watched:   data.WatchedPercent,
-		PlayTime:  data.PlaybackTimeSecs,
-		Timestamp: data.Timestamp,
+		EventID:      data.EventID,
+		AdID:         data.AdID,
+		ImpressionID: data.ImpressionID,
+		VariantID:    data.VariantID,
+		UserIP:       data.UserIP,
+		Agent:        data.UserAgent,
+		VisitorID:    data.VisitorID,
+		Fingerprint:  data.Fingerprint,
+		Watched:      data.WatchedPercent,
+		PlayTime:     data.PlaybackTimeSecs,
+		Timestamp:    data.Timestamp,
+		ReceivedAt:   time.Now().UnixMilli(),
 	}
 
+	publishCtx := context.WithoutCancel(ctx)
 	go func(ev queue.ClickEvent) {
 		maxRetries := 5
 		retryInterval := time.Second
 
 		for i := range maxRetries {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ctx, cancel := context.WithTimeout(publishCtx, 5*time.Second)
 			err := queue.PublishClick(ctx, ev)
 			cancel()
 
@@ -72,6 +179,9 @@ func (s *clickService) RecordClick(data ClickRequestData) error {
 			zap.Uint("ad_id", ev.AdID),
 			zap.String("event_id", ev.EventID.String()),
 		)
+		if claimed != nil {
+			s.release(publishCtx, claimed)
+		}
 	}(event)
 
 	return nil
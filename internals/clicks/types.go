@@ -7,7 +7,14 @@ type ClickRequestData struct {
 	PlaybackTimeSecs float64 `json:"playback_time_secs" binding:"gte=0"`
 	WatchedPercent   float64 `json:"watched_percent" binding:"gte=0,lte=100"`
 	Timestamp        int64   `json:"timestamp"`
-	UserIP           string
-	UserAgent        string
+	VisitorID        string  `json:"visitor_id" binding:"max=128"` // Client cookie/device id, optional
+	Token            string  `json:"token"`                        // Signed click token issued with the ad
 	EventID          uuid.UUID
+
+	// Set by the server, never bound from the request body
+	ImpressionID *uuid.UUID `json:"-"` // From a verified token
+	VariantID    *uint      `json:"-"` // From a verified token, for ads with variants
+	UserIP       string     `json:"-"`
+	UserAgent    string     `json:"-"`
+	Fingerprint  string     `json:"-"` // Salted hash of IP+UA
 }
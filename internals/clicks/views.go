@@ -1,12 +1,22 @@
 package clicks
 
 import (
+	"context"
+	"errors"
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/tracking"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+const (
+	visitorIDHeader    = "X-Visitor-ID"
+	visitorIDCookie    = "lv_vid"
+	maxVisitorIDLength = 128
+)
+
 type ClickHandler struct {
 	service Service
 }
@@ -25,12 +35,38 @@ func (h *ClickHandler) HandleClick(c *gin.Context) {
 	req.UserIP = c.ClientIP()
 	req.UserAgent = c.GetHeader("User-Agent")
 
+	// Visitor id: body field, then SDK header, then first-party cookie
+	if req.VisitorID == "" {
+		req.VisitorID = c.GetHeader(visitorIDHeader)
+	}
+	if req.VisitorID == "" {
+		if cookie, err := c.Cookie(visitorIDCookie); err == nil {
+			req.VisitorID = cookie
+		}
+	}
+	if len(req.VisitorID) > maxVisitorIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visitor_id too long"})
+		return
+	}
+
 	// Optional: support client-sent EventID for idempotency
 	if req.EventID == uuid.Nil {
 		req.EventID = uuid.New()
 	}
 
-	if err := h.service.RecordClick(req); err != nil {
+	if err := h.service.RecordClick(c.Request.Context(), req); err != nil {
+		switch {
+		case errors.Is(err, context.Canceled):
+			c.Status(config.StatusClientClosedRequest)
+			return
+		case errors.Is(err, ErrMissingToken), errors.Is(err, tracking.ErrInvalidToken), errors.Is(err, tracking.ErrExpiredToken),
+			errors.Is(err, ErrOutOfFlight):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, tracking.ErrReplayedToken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process click"})
 		return
 	}
@@ -3,6 +3,9 @@ package config
 import (
 	"lystage-proj/internals/observability"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +16,75 @@ type Config struct {
 	GinMode     string
 	KafkaBroker string
 	ClicksTopic string
+	AutoMigrate bool
+	GeoIPDBPath string
+	VisitorSalt string
+
+	ShutdownTimeout time.Duration // For background workers to flush
+
+	// Proxies whose X-Forwarded-For is believed for the client IP; empty
+	// trusts none and uses the connection's address
+	TrustedProxies []string
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	AnalyticsCacheBackend       string // memory or redis
+	AnalyticsCacheSize          int
+	AnalyticsCacheTTL           time.Duration
+	AnalyticsHistoricalCacheTTL time.Duration
+	AnalyticsStaleCacheTTL      time.Duration
+
+	LiveEmitInterval   time.Duration
+	LiveAllowedOrigins []string
+
+	// Server-side deadlines per endpoint
+	AdsQueryTimeout       time.Duration
+	ClickTimeout          time.Duration
+	AnalyticsQueryTimeout time.Duration
+	ExportTimeout         time.Duration
+
+	ReportWorkers    int
+	ReportMaxQueued  int
+	ReportJobTimeout time.Duration
+	ReportStoreDir   string
+	ReportRetention  time.Duration // How long finished jobs and their results are kept
+
+	FraudScoreThreshold       float64
+	FraudDatacenterRangesPath string // CIDR list, one range per line
+	FraudIPAdClicksPerMinute  int
+	FraudIPClicksPerMinute    int
+
+	// Click ingestion rate limits; a zero per-minute rate disables one
+	RateLimitBackend         string // memory or redis
+	RateLimitIPPerMinute     int
+	RateLimitIPBurst         int
+	RateLimitIPAdPerMinute   int
+	RateLimitIPAdBurst       int
+	RateLimitAPIKeyPerMinute int
+	RateLimitAPIKeyBurst     int
+	RateLimitAPIKeys         []string // Keys limited by api_key; others are not
+
+	// Signed click tokens; clicks are accepted unsigned without a secret
+	ClickTokenSecret  string
+	ClickTokenTTL     time.Duration
+	ClickTokenBackend string // Used-token store: memory or redis
+
+	// Hosts click tracking links may redirect to; empty allows any
+	RedirectAllowedHosts []string
+
+	AdServingRefreshInterval time.Duration // How long the active ad set is reused
+	FrequencyCapBackend      string        // Impression counters: memory or redis
+
+	// How often recorded spend is written out and budgets are enforced
+	BudgetFlushInterval time.Duration
+
+	// Campaign flights: how often ad statuses follow them, and what happens
+	// to clicks outside them (flag or reject) after the grace period
+	FlightSchedulerInterval time.Duration
+	FlightClickPolicy       string
+	FlightClickGrace        time.Duration
 }
 
 func Load() *Config {
@@ -25,6 +97,66 @@ func Load() *Config {
 		GinMode:     getEnv("GIN_MODE", "release"),
 		KafkaBroker: getEnv("KAFKA_BROKER", "localhost:9092"),
 		ClicksTopic: getEnv("CLICKS_TOPIC", "click-events"),
+		AutoMigrate: getEnv("AUTO_MIGRATE", "false") == "true",
+		GeoIPDBPath: getEnv("GEOIP_DB_PATH", ""),
+		VisitorSalt: getEnv("VISITOR_SALT", ""),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+
+		RedisAddr:     getEnv("REDIS_ADDR", ""),
+		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		RedisDB:       getEnvInt("REDIS_DB", 0),
+
+		AnalyticsCacheBackend:       getEnv("ANALYTICS_CACHE_BACKEND", "memory"),
+		AnalyticsCacheSize:          getEnvInt("ANALYTICS_CACHE_SIZE", 10000),
+		AnalyticsCacheTTL:           getEnvDuration("ANALYTICS_CACHE_TTL", 2*time.Minute),
+		AnalyticsHistoricalCacheTTL: getEnvDuration("ANALYTICS_HISTORICAL_CACHE_TTL", 30*time.Minute),
+		AnalyticsStaleCacheTTL:      getEnvDuration("ANALYTICS_STALE_CACHE_TTL", time.Minute),
+
+		LiveEmitInterval:   getEnvDuration("LIVE_EMIT_INTERVAL", time.Second),
+		LiveAllowedOrigins: getEnvList("LIVE_ALLOWED_ORIGINS"),
+
+		AdsQueryTimeout:       getEnvDuration("ADS_QUERY_TIMEOUT", 10*time.Second),
+		ClickTimeout:          getEnvDuration("CLICK_TIMEOUT", 5*time.Second),
+		AnalyticsQueryTimeout: getEnvDuration("ANALYTICS_QUERY_TIMEOUT", 30*time.Second),
+		ExportTimeout:         getEnvDuration("EXPORT_TIMEOUT", 10*time.Minute),
+
+		ReportWorkers:    getEnvInt("REPORT_WORKERS", 2),
+		ReportMaxQueued:  getEnvInt("REPORT_MAX_QUEUED", 100),
+		ReportJobTimeout: getEnvDuration("REPORT_JOB_TIMEOUT", 30*time.Minute),
+		ReportStoreDir:   getEnv("REPORT_STORE_DIR", "data/reports"),
+		ReportRetention:  getEnvDuration("REPORT_RETENTION", 7*24*time.Hour),
+
+		FraudScoreThreshold:       getEnvFloat("FRAUD_SCORE_THRESHOLD", 1.0),
+		FraudDatacenterRangesPath: getEnv("FRAUD_DATACENTER_RANGES_PATH", ""),
+		FraudIPAdClicksPerMinute:  getEnvInt("FRAUD_IP_AD_CLICKS_PER_MINUTE", 5),
+		FraudIPClicksPerMinute:    getEnvInt("FRAUD_IP_CLICKS_PER_MINUTE", 30),
+
+		RateLimitBackend:         getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitIPPerMinute:     getEnvInt("RATE_LIMIT_IP_PER_MINUTE", 120),
+		RateLimitIPBurst:         getEnvInt("RATE_LIMIT_IP_BURST", 20),
+		RateLimitIPAdPerMinute:   getEnvInt("RATE_LIMIT_IP_AD_PER_MINUTE", 20),
+		RateLimitIPAdBurst:       getEnvInt("RATE_LIMIT_IP_AD_BURST", 5),
+		RateLimitAPIKeyPerMinute: getEnvInt("RATE_LIMIT_API_KEY_PER_MINUTE", 6000),
+		RateLimitAPIKeyBurst:     getEnvInt("RATE_LIMIT_API_KEY_BURST", 500),
+		RateLimitAPIKeys:         getEnvList("RATE_LIMIT_API_KEYS"),
+
+		ClickTokenSecret:  getEnv("CLICK_TOKEN_SECRET", ""),
+		ClickTokenTTL:     getEnvDuration("CLICK_TOKEN_TTL", time.Hour),
+		ClickTokenBackend: getEnv("CLICK_TOKEN_BACKEND", "memory"),
+
+		RedirectAllowedHosts: getEnvList("REDIRECT_ALLOWED_HOSTS"),
+
+		AdServingRefreshInterval: getEnvDuration("AD_SERVING_REFRESH_INTERVAL", 30*time.Second),
+		FrequencyCapBackend:      getEnv("FREQUENCY_CAP_BACKEND", "memory"),
+
+		BudgetFlushInterval: getEnvDuration("BUDGET_FLUSH_INTERVAL", 15*time.Second),
+
+		FlightSchedulerInterval: getEnvDuration("FLIGHT_SCHEDULER_INTERVAL", time.Minute),
+		FlightClickPolicy:       getEnv("FLIGHT_CLICK_POLICY", "flag"),
+		FlightClickGrace:        getEnvDuration("FLIGHT_CLICK_GRACE", 30*time.Minute),
 	}
 	observability.Logger.Info(cfg.DatabaseURL)
 	return cfg
@@ -36,3 +168,43 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		observability.Logger.Warn("Invalid integer in environment, using default: " + key)
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		observability.Logger.Warn("Invalid number in environment, using default: " + key)
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		observability.Logger.Warn("Invalid duration in environment, using default: " + key)
+	}
+	return fallback
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
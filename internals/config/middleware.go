@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"lystage-proj/internals/observability"
 	"time"
 
@@ -8,6 +9,28 @@ import (
 	"go.uber.org/zap"
 )
 
+// StatusClientClosedRequest is recorded when the client disconnects before
+// a response could be written (nginx's 499).
+const StatusClientClosedRequest = 499
+
+// Timeout bounds the request context with a server-side deadline so that
+// handlers passing c.Request.Context() down stop their queries in time. A
+// non-positive timeout leaves the request unbounded.
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
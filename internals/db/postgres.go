@@ -1,8 +1,7 @@
 package db
 
 import (
-	// "lystage-proj/internals/ads"
-
+	"lystage-proj/internals/models"
 	"lystage-proj/internals/observability"
 
 	"go.uber.org/zap"
@@ -20,11 +19,19 @@ func InitPostgres(dsn string) *gorm.DB {
 	}
 
 	observability.Logger.Info("Connected to Postgres via GORM")
-	// if err := GormDB.AutoMigrate(
-	// 	&models.Click{}, &models.Ad{}, &models.AdAnalytics{}, &models.Impression{},
-	// ); err != nil {
-	// 	observability.Logger.Fatal("AutoMigrate failed", zap.Error(err))
-	// }
 
 	return GormDB
 }
+
+// Migrate brings the schema in line with the models. It only adds tables,
+// columns and indexes, so it is safe to run against an existing database.
+func Migrate() {
+	if err := GormDB.AutoMigrate(
+		&models.Advertiser{}, &models.Campaign{},
+		&models.Click{}, &models.Ad{}, &models.AdVariant{}, &models.Impression{}, &models.ClickRollup{}, &models.ServingRollup{}, &models.AdSpend{},
+		&models.ReportJob{}, &models.ReportSchedule{}, &models.ReportDelivery{},
+	); err != nil {
+		observability.Logger.Fatal("AutoMigrate failed", zap.Error(err))
+	}
+	observability.Logger.Info("Database schema migrated")
+}
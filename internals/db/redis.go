@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"lystage-proj/internals/observability"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var Redis *redis.Client
+
+// InitRedis connects to a Redis-protocol server shared by all replicas.
+func InitRedis(addr, password string, database int) *redis.Client {
+	Redis = redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       database,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := Redis.Ping(ctx).Err(); err != nil {
+		observability.Logger.Fatal("Failed to connect to Redis", zap.Error(err), zap.String("addr", addr))
+	}
+
+	observability.Logger.Info("Connected to Redis", zap.String("addr", addr))
+	return Redis
+}
+
+// CloseRedis closes the Redis client, if one was opened.
+func CloseRedis() error {
+	if Redis == nil {
+		return nil
+	}
+	return Redis.Close()
+}
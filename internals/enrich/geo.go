@@ -0,0 +1,94 @@
+package enrich
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoInfo is the location resolved for an IP address. Empty fields mean the
+// address could not be resolved.
+type GeoInfo struct {
+	Country string // ISO 3166-1 alpha-2
+	Region  string // ISO 3166-2 subdivision code, city databases only
+}
+
+var (
+	geoReader *geoip2.Reader
+	geoIsCity bool
+	geoMutex  sync.RWMutex
+)
+
+// InitGeoIP opens a local MaxMind-format (.mmdb) database used to resolve
+// click IPs. Both Country and City editions are supported; region is only
+// populated by City databases.
+func InitGeoIP(path string) error {
+	if path == "" {
+		return errors.New("geoip database path must be provided")
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+
+	geoMutex.Lock()
+	defer geoMutex.Unlock()
+
+	if geoReader != nil {
+		_ = geoReader.Close()
+	}
+	geoReader = reader
+	geoIsCity = strings.Contains(reader.Metadata().DatabaseType, "City")
+	return nil
+}
+
+// CloseGeoIP releases the GeoIP database, if one was opened.
+func CloseGeoIP() error {
+	geoMutex.Lock()
+	defer geoMutex.Unlock()
+
+	if geoReader == nil {
+		return nil
+	}
+	err := geoReader.Close()
+	geoReader = nil
+	return err
+}
+
+// LookupGeo resolves an IP to country and region. It returns an empty
+// GeoInfo when no database is loaded or the address is not found.
+func LookupGeo(ip string) GeoInfo {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return GeoInfo{}
+	}
+
+	geoMutex.RLock()
+	defer geoMutex.RUnlock()
+
+	if geoReader == nil {
+		return GeoInfo{}
+	}
+
+	if geoIsCity {
+		record, err := geoReader.City(parsed)
+		if err != nil {
+			return GeoInfo{}
+		}
+		info := GeoInfo{Country: record.Country.IsoCode}
+		if len(record.Subdivisions) > 0 {
+			info.Region = record.Subdivisions[0].IsoCode
+		}
+		return info
+	}
+
+	record, err := geoReader.Country(parsed)
+	if err != nil {
+		return GeoInfo{}
+	}
+	return GeoInfo{Country: record.Country.IsoCode}
+}
@@ -0,0 +1,26 @@
+package enrich
+
+// Dimensions are the derived attributes persisted alongside each click.
+type Dimensions struct {
+	DeviceType string
+	Browser    string
+	OS         string
+	Country    string
+	Region     string
+	IsBot      bool
+}
+
+// Resolve derives all click dimensions from the raw User-Agent and IP.
+func Resolve(userAgent, ip string) Dimensions {
+	ua := ParseUserAgent(userAgent)
+	geo := LookupGeo(ip)
+
+	return Dimensions{
+		DeviceType: ua.DeviceType,
+		Browser:    ua.Browser,
+		OS:         ua.OS,
+		Country:    geo.Country,
+		Region:     geo.Region,
+		IsBot:      ua.IsBot,
+	}
+}
@@ -0,0 +1,112 @@
+package enrich
+
+import "strings"
+
+const unknown = "unknown"
+
+// botMarkers are lowercase substrings that identify crawlers, scripts and
+// headless clients in a User-Agent header.
+var botMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests",
+	"python-urllib", "go-http-client", "java/", "headless", "phantomjs",
+	"facebookexternalhit", "preview", "scrapy", "httpclient",
+}
+
+// UserAgentInfo is the coarse classification of a User-Agent header.
+type UserAgentInfo struct {
+	DeviceType string // desktop, mobile, tablet, tv, bot, unknown
+	Browser    string
+	OS         string
+	IsBot      bool
+}
+
+// ParseUserAgent classifies a raw User-Agent header into device type,
+// browser and OS. It favours cheap substring checks over exhaustive
+// version parsing since only the family is stored on clicks.
+func ParseUserAgent(ua string) UserAgentInfo {
+	if strings.TrimSpace(ua) == "" {
+		return UserAgentInfo{DeviceType: unknown, Browser: unknown, OS: unknown}
+	}
+
+	s := strings.ToLower(ua)
+	info := UserAgentInfo{
+		Browser: parseBrowser(s),
+		OS:      parseOS(s),
+	}
+
+	for _, marker := range botMarkers {
+		if strings.Contains(s, marker) {
+			info.IsBot = true
+			info.DeviceType = "bot"
+			return info
+		}
+	}
+
+	info.DeviceType = parseDeviceType(s)
+	return info
+}
+
+func parseDeviceType(s string) string {
+	switch {
+	case containsAny(s, "smart-tv", "smarttv", "appletv", "googletv", "hbbtv", "roku", "crkey", "bravia", "tizen tv"):
+		return "tv"
+	case containsAny(s, "ipad", "tablet", "kindle", "silk/", "playbook"),
+		strings.Contains(s, "android") && !strings.Contains(s, "mobile"):
+		return "tablet"
+	case containsAny(s, "mobi", "iphone", "ipod", "android", "windows phone", "blackberry", "opera mini"):
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
+
+func parseBrowser(s string) string {
+	switch {
+	case containsAny(s, "edg/", "edge/", "edga/", "edgios/"):
+		return "Edge"
+	case containsAny(s, "opr/", "opera"):
+		return "Opera"
+	case strings.Contains(s, "samsungbrowser"):
+		return "Samsung Internet"
+	case containsAny(s, "firefox/", "fxios/"):
+		return "Firefox"
+	case containsAny(s, "chrome/", "crios/", "chromium/"):
+		return "Chrome"
+	case strings.Contains(s, "safari/") && strings.Contains(s, "version/"):
+		return "Safari"
+	case containsAny(s, "msie ", "trident/"):
+		return "Internet Explorer"
+	default:
+		return "other"
+	}
+}
+
+func parseOS(s string) string {
+	switch {
+	case strings.Contains(s, "windows phone"):
+		return "Windows Phone"
+	case strings.Contains(s, "windows"):
+		return "Windows"
+	case containsAny(s, "iphone", "ipad", "ipod"):
+		return "iOS"
+	case strings.Contains(s, "android"):
+		return "Android"
+	case containsAny(s, "mac os x", "macintosh"):
+		return "macOS"
+	case strings.Contains(s, "cros"):
+		return "ChromeOS"
+	case strings.Contains(s, "linux"):
+		return "Linux"
+	default:
+		return "other"
+	}
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package flight
+
+import (
+	"context"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/snapshot"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Checker tells whether events of an ad fall within its flight. Ads whose
+// campaign or advertiser is not active are never in flight. It works from a
+// snapshot of the flights of all ads, reloaded in the background at most
+// every refreshEvery.
+type Checker struct {
+	db      *gorm.DB
+	grace   time.Duration
+	flights *snapshot.Value[map[uint]Flights] // Only ads with a flight
+}
+
+// NewChecker creates a checker that also accepts events up to grace after
+// the flight has ended or left a scheduled hour, such as clicks on an ad
+// shown just before.
+func NewChecker(db *gorm.DB, refreshEvery, grace time.Duration) *Checker {
+	c := &Checker{db: db, grace: grace}
+	c.flights = snapshot.New("ad flights", refreshEvery, c.load)
+	return c
+}
+
+// InFlight reports whether an event of the ad at is within its flight. If
+// flights cannot be loaded every event is accepted.
+func (c *Checker) InFlight(adID uint, at time.Time) bool {
+	all, err := c.flights.Get(context.Background())
+	if err != nil {
+		return true
+	}
+
+	flights, ok := all[adID]
+	if !ok {
+		return true
+	}
+	return flights.Contains(at) || flights.Contains(at.Add(-c.grace))
+}
+
+func (c *Checker) load(ctx context.Context) (map[uint]Flights, error) {
+	var ads []models.Ad
+	err := c.db.WithContext(ctx).
+		Preload("Campaign.Advertiser").
+		Select("id", "start_at", "end_at", "schedule", "target_timezone", "campaign_id").
+		Where("start_at IS NOT NULL OR end_at IS NOT NULL OR schedule <> '' OR campaign_id IS NOT NULL").
+		Find(&ads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[uint]Flights)
+	for _, ad := range ads {
+		if !campaignActive(ad) {
+			all[ad.ID] = Flights{halted}
+			continue
+		}
+		flights, err := ForAdAndCampaign(ad)
+		if err != nil {
+			observability.Logger.Warn("Ignoring invalid ad flight", zap.Error(err), zap.Uint("ad_id", ad.ID))
+			continue
+		}
+		if flights.restricted() {
+			all[ad.ID] = flights
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,128 @@
+// Package flight decides when ads run: the start and end of their flight,
+// and their campaign's, and the hours of the week they are scheduled in.
+package flight
+
+import (
+	"fmt"
+	"lystage-proj/internals/models"
+	"time"
+)
+
+// PausedReason is models.Ad.PausedReason for ads paused by the Scheduler
+// outside their flight.
+const PausedReason = "flight"
+
+// Flight is when an ad or campaign may run. A nil *Flight runs always.
+type Flight struct {
+	start, end *time.Time
+	schedule   *Schedule
+	location   *time.Location
+	halted     bool // Contains no time
+}
+
+// halted is the flight of ads whose campaign or advertiser is not active.
+var halted = &Flight{halted: true}
+
+// New creates a flight from optional bounds and a ParseSchedule schedule
+// evaluated in timezone (IANA name, default UTC). It returns nil when
+// nothing restricts the flight.
+func New(start, end *time.Time, schedule, timezone string) (*Flight, error) {
+	if start != nil && end != nil && !end.After(*start) {
+		return nil, fmt.Errorf("end must be after start")
+	}
+
+	location := time.UTC
+	if timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+	}
+
+	var parsed *Schedule
+	if schedule != "" {
+		var err error
+		if parsed, err = ParseSchedule(schedule); err != nil {
+			return nil, fmt.Errorf("schedule: %w", err)
+		}
+	}
+
+	if start == nil && end == nil && parsed == nil {
+		return nil, nil
+	}
+	return &Flight{start: start, end: end, schedule: parsed, location: location}, nil
+}
+
+// ForAd returns an ad's own flight; its schedule is in its TargetTimezone.
+func ForAd(ad models.Ad) (*Flight, error) {
+	return New(ad.StartAt, ad.EndAt, ad.Schedule, ad.TargetTimezone)
+}
+
+// ForCampaign returns a campaign's flight, which applies to all its ads.
+func ForCampaign(campaign models.Campaign) (*Flight, error) {
+	return New(campaign.StartAt, campaign.EndAt, campaign.Schedule, campaign.Timezone)
+}
+
+// Contains reports whether t is within the flight: between its start and
+// end, inclusive of the start, and in a scheduled hour.
+func (f *Flight) Contains(t time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if f.halted {
+		return false
+	}
+	if f.start != nil && t.Before(*f.start) {
+		return false
+	}
+	if f.end != nil && !t.Before(*f.end) {
+		return false
+	}
+	return f.schedule == nil || f.schedule.Allows(t.In(f.location))
+}
+
+// Flights are all the flights an ad must be within to run.
+type Flights []*Flight
+
+// ForAdAndCampaign returns an ad's flight and, if it is preloaded, its
+// campaign's.
+func ForAdAndCampaign(ad models.Ad) (Flights, error) {
+	adFlight, err := ForAd(ad)
+	if err != nil {
+		return nil, err
+	}
+	flights := Flights{adFlight}
+	if ad.Campaign != nil {
+		campaignFlight, err := ForCampaign(*ad.Campaign)
+		if err != nil {
+			return nil, fmt.Errorf("campaign %d: %w", ad.Campaign.ID, err)
+		}
+		flights = append(flights, campaignFlight)
+	}
+	return flights, nil
+}
+
+// campaignActive reports whether an ad's preloaded campaign and its
+// advertiser are active. Ads outside any campaign are not held back.
+func campaignActive(ad models.Ad) bool {
+	return ad.Campaign == nil || (ad.Campaign.Status == "active" && ad.Campaign.Advertiser.Status == "active")
+}
+
+func (fs Flights) restricted() bool {
+	for _, f := range fs {
+		if f != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether t is within every flight.
+func (fs Flights) Contains(t time.Time) bool {
+	for _, f := range fs {
+		if !f.Contains(t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package flight
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a day-parting mask: which hours of the week, in local time,
+// are allowed. Index 0 is Sunday 00:00-01:00.
+type Schedule [7 * 24]bool
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses semicolon-separated entries of days and hours, such
+// as "mon-fri 9-17; sat,sun 10-14,20-23". Days are three-letter names,
+// ranges of them (which may wrap past Sunday) or "*" for every day; hours
+// are as for ParseHours, and an entry without hours covers the whole day.
+// A schedule must allow at least one hour.
+func ParseSchedule(spec string) (*Schedule, error) {
+	var schedule Schedule
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		daysStr, hoursStr, _ := strings.Cut(entry, " ")
+		days, err := parseDays(daysStr)
+		if err != nil {
+			return nil, err
+		}
+		hours := &[24]bool{}
+		for i := range hours {
+			hours[i] = true
+		}
+		if hoursStr = strings.TrimSpace(hoursStr); hoursStr != "" {
+			if hours, err = ParseHours(hoursStr); err != nil {
+				return nil, err
+			}
+		}
+
+		for day, on := range days {
+			if !on {
+				continue
+			}
+			for hour, allowed := range hours {
+				if allowed {
+					schedule[day*24+hour] = true
+				}
+			}
+		}
+	}
+	if schedule == (Schedule{}) {
+		return nil, fmt.Errorf("schedule %q allows no hours", spec)
+	}
+	return &schedule, nil
+}
+
+// Allows reports whether t, in the schedule's time zone, is in an allowed
+// hour.
+func (s *Schedule) Allows(t time.Time) bool {
+	return s[int(t.Weekday())*24+t.Hour()]
+}
+
+func parseDays(list string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(list, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "*" {
+			for i := range days {
+				days[i] = true
+			}
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, ok := weekdays[startStr]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", startStr)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdays[endStr]; !ok {
+				return days, fmt.Errorf("invalid day %q", endStr)
+			}
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// ParseHours parses comma-separated hour ranges such as "9-17,22-2".
+// Ranges exclude their end and may wrap past midnight, and a range
+// ending where it starts covers the whole day; a single number is that
+// one hour.
+func ParseHours(list string) (*[24]bool, error) {
+	var hours [24]bool
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := parseHour(startStr)
+		if err != nil {
+			return nil, err
+		}
+		if !isRange {
+			hours[start] = true
+			continue
+		}
+		end, err := parseHour(endStr)
+		if err != nil {
+			return nil, err
+		}
+		span := (end - start + 24) % 24
+		if span == 0 {
+			span = 24 // e.g. 0-24
+		}
+		for i := range span {
+			hours[(start+i)%24] = true
+		}
+	}
+	return &hours, nil
+}
+
+func parseHour(s string) (int, error) {
+	hour, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid hour %q", s)
+	}
+	return hour % 24, nil
+}
@@ -0,0 +1,106 @@
+package flight
+
+import (
+	"context"
+	"lystage-proj/internals/leader"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Scheduler pauses active ads outside their flight and resumes the ones it
+// paused once they are back in it. Only the replica elected by elector
+// does any work. Ads paused for any other reason are left alone.
+type Scheduler struct {
+	db       *gorm.DB
+	elector  leader.Elector
+	interval time.Duration
+}
+
+func NewScheduler(db *gorm.DB, elector leader.Elector, interval time.Duration) *Scheduler {
+	return &Scheduler{db: db, elector: elector, interval: interval}
+}
+
+// Run updates ad statuses every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	observability.Logger.Info("Flight scheduler started")
+
+	for {
+		if s.elector.IsLeader() {
+			if err := s.tick(ctx, time.Now()); err != nil {
+				observability.Logger.Error("Failed to update ad flights", zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context, now time.Time) error {
+	var ads []models.Ad
+	err := s.db.WithContext(ctx).
+		Preload("Campaign").
+		Select("id", "status", "paused_reason", "start_at", "end_at", "schedule", "target_timezone", "campaign_id").
+		Where("status = ? OR (status = ? AND paused_reason = ?)", "active", "paused", PausedReason).
+		Find(&ads).Error
+	if err != nil {
+		return err
+	}
+
+	var pause, resume []uint
+	for _, ad := range ads {
+		flights, err := ForAdAndCampaign(ad)
+		if err != nil {
+			observability.Logger.Warn("Skipping ad with invalid flight", zap.Error(err), zap.Uint("ad_id", ad.ID))
+			continue
+		}
+		inFlight := flights.Contains(now)
+		switch {
+		case ad.Status == "active" && !inFlight:
+			pause = append(pause, ad.ID)
+		case ad.Status == "paused" && inFlight:
+			resume = append(resume, ad.ID)
+		}
+	}
+
+	if err := s.update(ctx, pause, "active", "", "paused", PausedReason); err != nil {
+		return err
+	}
+	return s.update(ctx, resume, "paused", PausedReason, "active", "")
+}
+
+// update moves the ads still in status fromStatus with fromReason to
+// toStatus, so ads changed since they were read are not touched.
+func (s *Scheduler) update(ctx context.Context, adIDs []uint, fromStatus, fromReason, toStatus, toReason string) error {
+	if len(adIDs) == 0 {
+		return nil
+	}
+
+	query := s.db.WithContext(ctx).
+		Model(&models.Ad{}).
+		Where("id IN ? AND status = ?", adIDs, fromStatus)
+	if fromReason != "" {
+		query = query.Where("paused_reason = ?", fromReason)
+	}
+	result := query.Updates(map[string]interface{}{"status": toStatus, "paused_reason": toReason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		observability.AdFlightTransitions.WithLabelValues(toStatus).Add(float64(result.RowsAffected))
+		observability.Logger.Info("Updated ads on flight schedule",
+			zap.String("status", toStatus),
+			zap.Int64("ads", result.RowsAffected))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package fraud scores clicks against a set of rules before they are
+// persisted, so that suspicious clicks can be excluded from analytics.
+package fraud
+
+import (
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reason codes recorded on flagged clicks.
+const (
+	ReasonBotUserAgent    = "bot_user_agent"
+	ReasonDatacenterIP    = "datacenter_ip"
+	ReasonImpossibleWatch = "zero_playback_full_watch"
+	ReasonIPAdVelocity    = "ip_ad_velocity"
+	ReasonIPVelocity      = "ip_velocity"
+	ReasonEventBurst      = "event_burst"
+	ReasonOutOfFlight     = "out_of_flight"
+)
+
+// DefaultScoreThreshold is the score at which a click is flagged.
+const DefaultScoreThreshold = 1.0
+
+const (
+	reasonSeparator        = ","
+	maxStoredReasonsLength = 255 // models.Click.FraudReasons column size
+)
+
+// Signal is one rule's finding about a click.
+type Signal struct {
+	Reason string
+	Score  float64
+}
+
+// Rule inspects a click about to be persisted. Rules must be safe for
+// concurrent use.
+type Rule interface {
+	Check(click *models.Click, isBot bool) *Signal
+}
+
+// Recorder is implemented by rules that keep state across clicks. Check
+// must not change that state; Record updates it once the click has been
+// stored, so that redelivered events are not counted twice.
+type Recorder interface {
+	Record(click *models.Click)
+}
+
+// Verdict is the combined outcome of all rules for a click.
+type Verdict struct {
+	Score      float64
+	Reasons    []string
+	Fraudulent bool
+}
+
+// Engine runs every rule on each click and flags it once the summed score
+// of the signals reaches the threshold.
+type Engine struct {
+	rules     []Rule
+	threshold float64
+}
+
+// NewEngine creates an engine flagging clicks whose score reaches
+// threshold.
+func NewEngine(threshold float64, rules ...Rule) *Engine {
+	if threshold <= 0 {
+		threshold = DefaultScoreThreshold
+	}
+	return &Engine{rules: rules, threshold: threshold}
+}
+
+// Options configure the built-in rules of NewDefaultEngine.
+type Options struct {
+	Threshold        float64
+	DatacenterRanges []netip.Prefix // No datacenter rule if empty
+	IPAdPerMinute    int            // Clicks allowed from one IP on one ad
+	IPPerMinute      int            // Clicks allowed from one IP across ads
+	Flights          FlightChecker  // No out-of-flight rule if nil
+}
+
+// NewDefaultEngine creates an engine with the built-in rules. Rules that
+// alone prove a click is not genuine score the full threshold; weaker
+// signals only flag a click in combination.
+func NewDefaultEngine(opts Options) *Engine {
+	engine := NewEngine(opts.Threshold)
+	full := engine.threshold
+
+	engine.Register(BotUserAgentRule{Score: full})
+	engine.Register(ImpossibleWatchRule{Score: full})
+	engine.Register(NewIPAdVelocityRule(full, opts.IPAdPerMinute, time.Minute))
+	engine.Register(NewIPVelocityRule(full*0.6, opts.IPPerMinute, time.Minute))
+	engine.Register(NewEventBurstRule(full*0.6, 2, 10*time.Second))
+	if len(opts.DatacenterRanges) > 0 {
+		engine.Register(NewDatacenterRule(full*0.5, opts.DatacenterRanges))
+	}
+	if opts.Flights != nil {
+		engine.Register(NewOutOfFlightRule(full*0.6, opts.Flights))
+	}
+	return engine
+}
+
+// Register adds a rule to the engine. It must not be called while clicks
+// are being evaluated.
+func (e *Engine) Register(rule Rule) {
+	e.rules = append(e.rules, rule)
+}
+
+// Evaluate scores a click. isBot is the user agent classification from
+// enrichment.
+func (e *Engine) Evaluate(click *models.Click, isBot bool) Verdict {
+	var verdict Verdict
+	for _, rule := range e.rules {
+		if signal := rule.Check(click, isBot); signal != nil {
+			verdict.Score += signal.Score
+			verdict.Reasons = append(verdict.Reasons, signal.Reason)
+		}
+	}
+	sort.Strings(verdict.Reasons)
+	verdict.Fraudulent = verdict.Score >= e.threshold
+	return verdict
+}
+
+// Record counts a click once it has been stored with verdict: rules that
+// keep state see it, and the verdict is added to the metrics.
+func (e *Engine) Record(click *models.Click, verdict Verdict) {
+	for _, rule := range e.rules {
+		if recorder, ok := rule.(Recorder); ok {
+			recorder.Record(click)
+		}
+	}
+
+	for _, reason := range verdict.Reasons {
+		observability.FraudSignals.WithLabelValues(reason).Inc()
+	}
+	if verdict.Fraudulent {
+		observability.FraudulentClicks.Inc()
+	}
+}
+
+// Apply evaluates a click and records the verdict on it.
+func (e *Engine) Apply(click *models.Click, isBot bool) Verdict {
+	verdict := e.Evaluate(click, isBot)
+	click.IsFraudulent = verdict.Fraudulent
+	click.FraudScore = verdict.Score
+	click.FraudReasons = JoinReasons(verdict.Reasons)
+	return verdict
+}
+
+// JoinReasons encodes reason codes for storage.
+func JoinReasons(reasons []string) string {
+	joined := strings.Join(reasons, reasonSeparator)
+	if len(joined) > maxStoredReasonsLength {
+		joined = joined[:maxStoredReasonsLength]
+	}
+	return joined
+}
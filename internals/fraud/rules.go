@@ -0,0 +1,185 @@
+package fraud
+
+import (
+	"bufio"
+	"fmt"
+	"lystage-proj/internals/models"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// BotUserAgentRule flags user agents classified as crawlers or scripts.
+type BotUserAgentRule struct {
+	Score float64
+}
+
+func (r BotUserAgentRule) Check(_ *models.Click, isBot bool) *Signal {
+	if !isBot {
+		return nil
+	}
+	return &Signal{Reason: ReasonBotUserAgent, Score: r.Score}
+}
+
+// ImpossibleWatchRule flags clicks reporting the whole ad watched with no
+// playback time, which a real player cannot produce.
+type ImpossibleWatchRule struct {
+	Score float64
+}
+
+func (r ImpossibleWatchRule) Check(click *models.Click, _ bool) *Signal {
+	if click.PlaybackTimeSec > 0 || click.WatchedPercent < 100 {
+		return nil
+	}
+	return &Signal{Reason: ReasonImpossibleWatch, Score: r.Score}
+}
+
+// DatacenterRule flags clicks from IP ranges of hosting providers, where
+// real viewers rarely come from.
+type DatacenterRule struct {
+	Score    float64
+	prefixes []netip.Prefix
+}
+
+// NewDatacenterRule creates a rule matching the given CIDR ranges.
+func NewDatacenterRule(score float64, prefixes []netip.Prefix) *DatacenterRule {
+	return &DatacenterRule{Score: score, prefixes: prefixes}
+}
+
+// LoadCIDRFile reads one CIDR range (or bare IP) per line, ignoring blank
+// lines and # comments.
+func LoadCIDRFile(path string) ([]netip.Prefix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(text)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%s:%d: invalid range %q", path, line, text)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, scanner.Err()
+}
+
+func (r *DatacenterRule) Check(click *models.Click, _ bool) *Signal {
+	addr, err := netip.ParseAddr(click.UserIP)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	for _, prefix := range r.prefixes {
+		if prefix.Contains(addr) {
+			return &Signal{Reason: ReasonDatacenterIP, Score: r.Score}
+		}
+	}
+	return nil
+}
+
+// VelocityRule flags a key clicking more than Limit times within Window.
+// Counts are kept per worker process, so with several consumers each
+// enforces the limit on the clicks it sees.
+type VelocityRule struct {
+	Reason string
+	Score  float64
+	Limit  int
+	key    func(click *models.Click) string
+	window *slidingWindow
+}
+
+// NewIPAdVelocityRule limits clicks from one IP on one ad.
+func NewIPAdVelocityRule(score float64, limit int, window time.Duration) *VelocityRule {
+	return &VelocityRule{
+		Reason: ReasonIPAdVelocity,
+		Score:  score,
+		Limit:  limit,
+		key:    func(c *models.Click) string { return fmt.Sprintf("%s|%d", c.UserIP, c.AdID) },
+		window: newSlidingWindow(window),
+	}
+}
+
+// NewIPVelocityRule limits clicks from one IP across all ads.
+func NewIPVelocityRule(score float64, limit int, window time.Duration) *VelocityRule {
+	return &VelocityRule{
+		Reason: ReasonIPVelocity,
+		Score:  score,
+		Limit:  limit,
+		key:    func(c *models.Click) string { return c.UserIP },
+		window: newSlidingWindow(window),
+	}
+}
+
+// NewEventBurstRule flags the same visitor clicking one ad repeatedly in
+// a short burst, e.g. a replayed or scripted event.
+func NewEventBurstRule(score float64, limit int, window time.Duration) *VelocityRule {
+	return &VelocityRule{
+		Reason: ReasonEventBurst,
+		Score:  score,
+		Limit:  limit,
+		key: func(c *models.Click) string {
+			visitor := c.VisitorID
+			if visitor == "" {
+				visitor = c.Fingerprint
+			}
+			if visitor == "" {
+				visitor = c.UserIP
+			}
+			return fmt.Sprintf("%s|%d", visitor, c.AdID)
+		},
+		window: newSlidingWindow(window),
+	}
+}
+
+func (r *VelocityRule) Check(click *models.Click, _ bool) *Signal {
+	if r.window.Count(r.key(click), click.CreatedAt) <= r.Limit {
+		return nil
+	}
+	return &Signal{Reason: r.Reason, Score: r.Score}
+}
+
+// Record counts a stored click towards the limit.
+func (r *VelocityRule) Record(click *models.Click) {
+	r.window.Add(r.key(click), click.CreatedAt)
+}
+
+// FlightChecker tells whether an ad was running at a time, e.g.
+// *flight.Checker.
+type FlightChecker interface {
+	InFlight(adID uint, at time.Time) bool
+}
+
+// OutOfFlightRule flags clicks on ads outside their campaign flight or
+// schedule, as of when the API received them. Clicks through a click token
+// are left alone: their impression was served, and so was in flight, and
+// the token's expiry bounds how late they can come.
+type OutOfFlightRule struct {
+	Score   float64
+	flights FlightChecker
+}
+
+func NewOutOfFlightRule(score float64, flights FlightChecker) *OutOfFlightRule {
+	return &OutOfFlightRule{Score: score, flights: flights}
+}
+
+func (r *OutOfFlightRule) Check(click *models.Click, _ bool) *Signal {
+	if click.ImpressionID != nil || r.flights.InFlight(click.AdID, click.CreatedAt) {
+		return nil
+	}
+	return &Signal{Reason: ReasonOutOfFlight, Score: r.Score}
+}
@@ -0,0 +1,76 @@
+package fraud
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many additions pass between sweeps of idle keys.
+const sweepEvery = 10000
+
+// slidingWindow counts events per key over the trailing window.
+type slidingWindow struct {
+	mu     sync.Mutex
+	window time.Duration
+	events map[string][]time.Time
+	adds   int
+}
+
+func newSlidingWindow(window time.Duration) *slidingWindow {
+	return &slidingWindow{window: window, events: make(map[string][]time.Time)}
+}
+
+// Count returns the number of events for key within the window ending at
+// t, counting one more at t without recording it.
+func (w *slidingWindow) Count(key string, t time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cutoff := t.Add(-w.window)
+	count := 1
+	for _, event := range w.events[key] {
+		if event.After(cutoff) && !event.After(t) {
+			count++
+		}
+	}
+	return count
+}
+
+// Add records an event at t. Events may arrive slightly out of order, so
+// it is inserted in time order.
+func (w *slidingWindow) Add(key string, t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cutoff := t.Add(-w.window)
+	events := prune(w.events[key], cutoff)
+	i := sort.Search(len(events), func(i int) bool { return events[i].After(t) })
+	events = slices.Insert(events, i, t)
+	w.events[key] = events
+
+	if w.adds++; w.adds%sweepEvery == 0 {
+		w.sweep(cutoff)
+	}
+}
+
+// sweep drops keys with no events after cutoff; callers must hold w.mu.
+func (w *slidingWindow) sweep(cutoff time.Time) {
+	for key, events := range w.events {
+		if events = prune(events, cutoff); len(events) == 0 {
+			delete(w.events, key)
+		} else {
+			w.events[key] = events
+		}
+	}
+}
+
+// prune drops events at or before cutoff; events are in time order.
+func prune(events []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	return events[i:]
+}
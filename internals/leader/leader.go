@@ -0,0 +1,129 @@
+// Package leader elects a single replica to run background jobs that would
+// otherwise be duplicated across every instance.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"lystage-proj/internals/observability"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Elector reports whether this replica currently holds leadership.
+type Elector interface {
+	IsLeader() bool
+}
+
+// Always is the Elector for single-replica deployments: it is always leader.
+type Always struct{}
+
+func (Always) IsLeader() bool { return true }
+
+// renewScript extends the lease only if this replica still owns it.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease only if this replica still owns it.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisElector holds a named lease in Redis. The lease expires after ttl
+// unless renewed, so a crashed leader is replaced within one ttl.
+type RedisElector struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+	leader atomic.Bool
+}
+
+// NewRedisElector creates an elector for the named job. Call Run to start
+// campaigning.
+func NewRedisElector(client *redis.Client, name string, ttl time.Duration) *RedisElector {
+	host, _ := os.Hostname()
+	return &RedisElector{
+		client: client,
+		key:    "lvstage:leader:" + name,
+		id:     fmt.Sprintf("%s-%s", host, uuid.NewString()),
+		ttl:    ttl,
+	}
+}
+
+func (e *RedisElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run acquires or renews the lease every third of its ttl until ctx is
+// done, then releases it.
+func (e *RedisElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *RedisElector) campaign(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+
+	var (
+		held bool
+		err  error
+	)
+	if e.leader.Load() {
+		var renewed int64
+		renewed, err = renewScript.Run(ctx, e.client, []string{e.key}, e.id, e.ttl.Milliseconds()).Int64()
+		held = renewed == 1
+	} else {
+		held, err = e.client.SetNX(ctx, e.key, e.id, e.ttl).Result()
+	}
+
+	if err != nil {
+		// Step down rather than risk two leaders while Redis is unreachable
+		observability.Logger.Warn("Leader election failed", zap.Error(err), zap.String("lease", e.key))
+		held = false
+	}
+
+	if was := e.leader.Swap(held); was != held {
+		observability.Logger.Info("Leadership changed",
+			zap.String("lease", e.key),
+			zap.String("id", e.id),
+			zap.Bool("leader", held))
+	}
+}
+
+func (e *RedisElector) release() {
+	if !e.leader.Swap(false) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := releaseScript.Run(ctx, e.client, []string{e.key}, e.id).Err(); err != nil {
+		observability.Logger.Warn("Failed to release leadership", zap.Error(err), zap.String("lease", e.key))
+	}
+}
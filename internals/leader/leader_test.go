@@ -0,0 +1,143 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/redistest"
+
+	"go.uber.org/zap"
+)
+
+const testTTL = 3 * time.Second
+
+func newTestElectors(t *testing.T, n int) (*redistest.Server, []*RedisElector) {
+	observability.Logger = zap.NewNop()
+
+	server := redistest.NewServer(t)
+	client := server.NewClient(t)
+	electors := make([]*RedisElector, n)
+	for i := range electors {
+		electors[i] = NewRedisElector(client, "test", testTTL)
+	}
+	return server, electors
+}
+
+func TestSingleLeader(t *testing.T) {
+	server, e := newTestElectors(t, 2)
+	ctx := context.Background()
+
+	e[0].campaign(ctx)
+	e[1].campaign(ctx)
+	if !e[0].IsLeader() || e[1].IsLeader() {
+		t.Fatalf("leaders = %t, %t, want only the first", e[0].IsLeader(), e[1].IsLeader())
+	}
+	if owner, _ := server.Get(e[0].key); owner != e[0].id {
+		t.Fatalf("lease owner = %q, want %q", owner, e[0].id)
+	}
+}
+
+func TestRenewExtendsLease(t *testing.T) {
+	server, e := newTestElectors(t, 2)
+	ctx := context.Background()
+
+	e[0].campaign(ctx)
+	server.FastForward(testTTL - time.Second)
+	e[0].campaign(ctx)
+	if ttl := server.TTL(e[0].key); ttl != testTTL {
+		t.Fatalf("ttl after renewal = %s, want %s", ttl, testTTL)
+	}
+
+	server.FastForward(testTTL - time.Second)
+	e[1].campaign(ctx)
+	if !e[0].IsLeader() || e[1].IsLeader() {
+		t.Fatalf("renewed lease was taken over")
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	server, e := newTestElectors(t, 2)
+	ctx := context.Background()
+
+	e[0].campaign(ctx)
+	server.FastForward(testTTL)
+	e[1].campaign(ctx)
+	if !e[1].IsLeader() {
+		t.Fatal("expired lease was not acquired")
+	}
+
+	// The old leader must not renew a lease it no longer owns
+	e[0].campaign(ctx)
+	if e[0].IsLeader() {
+		t.Fatal("old leader kept leadership")
+	}
+	if owner, _ := server.Get(e[1].key); owner != e[1].id {
+		t.Fatalf("lease owner = %q, want %q", owner, e[1].id)
+	}
+}
+
+func TestReleaseOnlyOwnLease(t *testing.T) {
+	server, e := newTestElectors(t, 2)
+	ctx := context.Background()
+
+	e[0].campaign(ctx)
+	server.FastForward(testTTL)
+	e[1].campaign(ctx)
+
+	// e[0] still believes it leads; releasing must not drop e[1]'s lease
+	e[0].release()
+	if owner, ok := server.Get(e[1].key); !ok || owner != e[1].id {
+		t.Fatalf("lease owner = %q, want %q", owner, e[1].id)
+	}
+
+	e[1].release()
+	if _, ok := server.Get(e[1].key); ok {
+		t.Fatal("lease not released")
+	}
+}
+
+func TestRunReleasesLeaseWhenDone(t *testing.T) {
+	server, e := newTestElectors(t, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		e[0].Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(testTTL)
+	for !e[0].IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("never became leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if e[0].IsLeader() {
+		t.Fatal("still leader after Run returned")
+	}
+	if _, ok := server.Get(e[0].key); ok {
+		t.Fatal("lease not released when Run returned")
+	}
+}
+
+func TestStepsDownWhenRedisIsUnreachable(t *testing.T) {
+	server, e := newTestElectors(t, 1)
+	ctx := context.Background()
+
+	e[0].campaign(ctx)
+	if !e[0].IsLeader() {
+		t.Fatal("never became leader")
+	}
+
+	server.Close()
+	e[0].campaign(ctx)
+	if e[0].IsLeader() {
+		t.Fatal("kept leadership without Redis")
+	}
+}
@@ -0,0 +1,50 @@
+// Package lifecycle ties background loops to the life of the process, so
+// that they stop on shutdown and get to flush what they have buffered.
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group runs loops until it is stopped.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs loop in a goroutine. Its context is cancelled by Stop, after
+// which it should finish its work and return.
+func (g *Group) Go(loop func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		loop(g.ctx)
+	}()
+}
+
+// Stop cancels the loops and waits up to timeout for them to return. It
+// reports whether they all did.
+func (g *Group) Stop(timeout time.Duration) bool {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,165 @@
+// Package live pushes per-ad click deltas to connected dashboards as the
+// worker persists clicks.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"lystage-proj/internals/observability"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// redisChannel carries click events between replicas when a shared Redis
+// is configured, since each replica's worker only consumes its own Kafka
+// partitions.
+const redisChannel = "lvstage:live:clicks"
+
+// subscriptionBuffer is how many events a slow subscriber may lag behind
+// before events are dropped for it.
+const subscriptionBuffer = 1024
+
+// Event is a persisted click as seen by live subscribers.
+type Event struct {
+	AdID            uint      `json:"ad_id"`
+	PlaybackTimeSec float64   `json:"playback_time_sec"`
+	WatchedPercent  float64   `json:"watched_percent"`
+	At              time.Time `json:"at"`
+}
+
+// Hub fans click events out to subscriptions.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	client *redis.Client
+}
+
+// Subscription receives events for a set of ads, or all ads if the set is
+// empty.
+type Subscription struct {
+	Events chan Event
+	adIDs  map[uint]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// DefaultHub is the process-wide hub the worker publishes to.
+var DefaultHub = NewHub()
+
+// Publish sends a click event to DefaultHub.
+func Publish(ev Event) {
+	DefaultHub.Publish(ev)
+}
+
+// UseRedis relays events through Redis pub/sub so subscribers on every
+// replica see clicks persisted by any worker. It blocks relaying until ctx
+// is done, then unsubscribes.
+func (h *Hub) UseRedis(ctx context.Context, client *redis.Client) {
+	pubsub := client.Subscribe(ctx, redisChannel)
+	defer pubsub.Close()
+
+	h.mu.Lock()
+	h.client = client
+	h.mu.Unlock()
+
+	// Events published after the relay stops are dispatched locally
+	defer func() {
+		h.mu.Lock()
+		h.client = nil
+		h.mu.Unlock()
+	}()
+
+	observability.Logger.Info("Live analytics relaying through Redis", zap.String("channel", redisChannel))
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				observability.Logger.Warn("Invalid live click event", zap.Error(err))
+				continue
+			}
+			h.dispatch(ev)
+		}
+	}
+}
+
+// Publish delivers an event to matching subscriptions, via Redis when
+// configured.
+func (h *Hub) Publish(ev Event) {
+	h.mu.RLock()
+	client := h.client
+	h.mu.RUnlock()
+
+	if client == nil {
+		h.dispatch(ev)
+		return
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Publish(ctx, redisChannel, data).Err(); err != nil {
+		observability.Logger.Warn("Failed to relay live click event", zap.Error(err))
+		h.dispatch(ev) // Local subscribers still get it
+	}
+}
+
+func (h *Hub) dispatch(ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		if len(sub.adIDs) > 0 && !sub.adIDs[ev.AdID] {
+			continue
+		}
+		select {
+		case sub.Events <- ev:
+		default:
+			observability.LiveEventsDropped.Inc()
+		}
+	}
+}
+
+// Subscribe registers a subscription for the given ads; no IDs means all
+// ads. Callers must Unsubscribe when done.
+func (h *Hub) Subscribe(adIDs []uint) *Subscription {
+	sub := &Subscription{
+		Events: make(chan Event, subscriptionBuffer),
+		adIDs:  make(map[uint]bool, len(adIDs)),
+	}
+	for _, id := range adIDs {
+		sub.adIDs[id] = true
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	observability.LiveSubscribers.Inc()
+
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		observability.LiveSubscribers.Dec()
+	}
+	h.mu.Unlock()
+}
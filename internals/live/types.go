@@ -0,0 +1,60 @@
+package live
+
+import (
+	"sort"
+	"time"
+)
+
+// AdDelta is the change in an ad's counters over one emit interval.
+type AdDelta struct {
+	AdID              uint    `json:"ad_id"`
+	Clicks            int64   `json:"clicks"`
+	PlaybackTimeSum   float64 `json:"playback_time_sum"`
+	WatchedPercentSum float64 `json:"watched_percent_sum"`
+}
+
+// Snapshot is one message pushed to a live client.
+type Snapshot struct {
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Ads         []AdDelta `json:"ads"`
+}
+
+// window accumulates deltas between emits.
+type window struct {
+	start time.Time
+	ads   map[uint]*AdDelta
+}
+
+func newWindow() *window {
+	return &window{start: time.Now(), ads: make(map[uint]*AdDelta)}
+}
+
+func (w *window) add(ev Event) {
+	d, ok := w.ads[ev.AdID]
+	if !ok {
+		d = &AdDelta{AdID: ev.AdID}
+		w.ads[ev.AdID] = d
+	}
+	d.Clicks++
+	d.PlaybackTimeSum += ev.PlaybackTimeSec
+	d.WatchedPercentSum += ev.WatchedPercent
+}
+
+// flush returns the accumulated deltas ordered by ad and starts a new
+// window.
+func (w *window) flush() Snapshot {
+	snap := Snapshot{
+		WindowStart: w.start,
+		WindowEnd:   time.Now(),
+		Ads:         make([]AdDelta, 0, len(w.ads)),
+	}
+	for _, d := range w.ads {
+		snap.Ads = append(snap.Ads, *d)
+	}
+	sort.Slice(snap.Ads, func(i, j int) bool { return snap.Ads[i].AdID < snap.Ads[j].AdID })
+
+	w.start = snap.WindowEnd
+	w.ads = make(map[uint]*AdDelta)
+	return snap
+}
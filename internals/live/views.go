@@ -0,0 +1,180 @@
+package live
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"lystage-proj/internals/observability"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	minEmitInterval   = 250 * time.Millisecond
+	maxEmitInterval   = time.Minute
+	keepAliveInterval = 15 * time.Second
+	maxSubscribedAds  = 500
+	wsWriteTimeout    = 10 * time.Second
+)
+
+type Handler struct {
+	hub             *Hub
+	defaultInterval time.Duration
+	upgrader        websocket.Upgrader
+}
+
+// NewHandler creates live stream handlers. allowedOrigins lists the
+// origins allowed to open WebSockets; empty means same-origin only.
+func NewHandler(hub *Hub, defaultInterval time.Duration, allowedOrigins []string) *Handler {
+	h := &Handler{hub: hub, defaultInterval: defaultInterval}
+	if len(allowedOrigins) > 0 {
+		allowed := make(map[string]bool, len(allowedOrigins))
+		for _, origin := range allowedOrigins {
+			allowed[origin] = true
+		}
+		h.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return allowed["*"] || allowed[r.Header.Get("Origin")]
+		}
+	}
+	return h
+}
+
+// StreamAnalytics handles GET /ads/analytics/stream, pushing a "delta"
+// Server-Sent Event every interval in which subscribed ads were clicked.
+func (h *Handler) StreamAnalytics(c *gin.Context) {
+	adIDs, interval, err := h.parseSubscription(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := h.hub.Subscribe(adIDs)
+	defer h.hub.Unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+
+	emit := time.NewTicker(interval)
+	defer emit.Stop()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	win := newWindow()
+	observability.Logger.Debug("Live SSE client connected",
+		zap.Int("ad_ids", len(adIDs)),
+		zap.Duration("interval", interval),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev := <-sub.Events:
+			win.add(ev)
+		case <-emit.C:
+			if snap := win.flush(); len(snap.Ads) > 0 {
+				c.SSEvent("delta", snap)
+			}
+		case <-keepAlive.C:
+			c.SSEvent("ping", time.Now())
+		}
+		return true
+	})
+}
+
+// AnalyticsWebSocket handles GET /ads/analytics/ws, the WebSocket variant of
+// StreamAnalytics. Each text message is a JSON Snapshot.
+func (h *Handler) AnalyticsWebSocket(c *gin.Context) {
+	adIDs, interval, err := h.parseSubscription(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		observability.Logger.Warn("WebSocket upgrade failed", zap.Error(err))
+		return // Upgrade already wrote the HTTP error
+	}
+	defer conn.Close()
+
+	sub := h.hub.Subscribe(adIDs)
+	defer h.hub.Unsubscribe(sub)
+
+	// The read loop only watches for the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	emit := time.NewTicker(interval)
+	defer emit.Stop()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	win := newWindow()
+	for {
+		select {
+		case <-closed:
+			return
+		case ev := <-sub.Events:
+			win.add(ev)
+		case <-emit.C:
+			snap := win.flush()
+			if len(snap.Ads) == 0 {
+				continue
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(snap); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseSubscription reads ad_ids (comma-separated, optional) and interval
+// (Go duration, optional) query parameters.
+func (h *Handler) parseSubscription(c *gin.Context) ([]uint, time.Duration, error) {
+	var adIDs []uint
+	if adIDsStr := c.Query("ad_ids"); adIDsStr != "" {
+		for _, part := range strings.Split(adIDsStr, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+			if err != nil || id == 0 {
+				return nil, 0, fmt.Errorf("invalid ad id %q", part)
+			}
+			adIDs = append(adIDs, uint(id))
+		}
+		if len(adIDs) > maxSubscribedAds {
+			return nil, 0, fmt.Errorf("at most %d ad_ids per subscription", maxSubscribedAds)
+		}
+	}
+
+	interval := h.defaultInterval
+	if intervalStr := c.Query("interval"); intervalStr != "" {
+		parsed, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, 0, errors.New("interval must be a duration such as 1s or 500ms")
+		}
+		interval = parsed
+	}
+	if interval < minEmitInterval || interval > maxEmitInterval {
+		return nil, 0, fmt.Errorf("interval must be between %s and %s", minEmitInterval, maxEmitInterval)
+	}
+
+	return adIDs, interval, nil
+}
@@ -10,4 +10,40 @@ type Ad struct {
 	Status    string    `gorm:"size:50;default:'active';index" json:"status"` // active, paused, archived
 	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Serving: share among eligible ads and targeting rules; empty rules match everyone
+	Weight           int    `gorm:"not null;default:1" json:"weight"`
+	TargetGeos       string `gorm:"size:500" json:"target_geos,omitempty"`       // Comma-separated countries (IN) or regions (IN-KA)
+	TargetDevices    string `gorm:"size:100" json:"target_devices,omitempty"`    // Comma-separated device types
+	TargetPlacements string `gorm:"size:500" json:"target_placements,omitempty"` // Comma-separated placement names
+	TargetHours      string `gorm:"size:100" json:"target_hours,omitempty"`      // Local hour ranges, e.g. 9-17,20-23 (end exclusive)
+	TargetTimezone   string `gorm:"size:64" json:"target_timezone,omitempty"`    // IANA zone for TargetHours and Schedule, default UTC
+
+	// Flight: the ad runs from StartAt until EndAt, in the hours of the week
+	// Schedule allows (e.g. mon-fri 9-17; sat 10-14), and is paused outside
+	// it with PausedReason flight
+	StartAt  *time.Time `gorm:"index" json:"start_at,omitempty"`
+	EndAt    *time.Time `gorm:"index" json:"end_at,omitempty"`
+	Schedule string     `gorm:"size:500" json:"schedule,omitempty"`
+
+	// Frequency cap: at most FrequencyCap impressions per visitor in each
+	// window of FrequencyCapWindowSecs, counted from their first; 0 is uncapped
+	FrequencyCap           int `gorm:"not null;default:0" json:"frequency_cap"`
+	FrequencyCapWindowSecs int `gorm:"not null;default:86400" json:"frequency_cap_window_secs"`
+
+	// Pricing and budgets: spend accrues Bid per click (cpc) or per thousand
+	// impressions (cpm); budgets of 0 are unlimited. PausedReason is set when
+	// the ad is paused automatically, e.g. daily_budget
+	PricingModel   string  `gorm:"size:10;not null;default:'cpc'" json:"pricing_model"`
+	Bid            float64 `gorm:"not null;default:0" json:"bid"`
+	DailyBudget    float64 `gorm:"not null;default:0" json:"daily_budget"`
+	LifetimeBudget float64 `gorm:"not null;default:0" json:"lifetime_budget"`
+	PausedReason   string  `gorm:"size:50" json:"paused_reason,omitempty"`
+
+	// Campaign the ad belongs to, if any; ads are unassigned when it is deleted
+	CampaignID *uint     `gorm:"index" json:"campaign_id,omitempty"`
+	Campaign   *Campaign `gorm:"constraint:OnDelete:SET NULL" json:"-"`
+
+	// Creative variants under test; without any, the ad's own creative is served
+	Variants []AdVariant `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 }
@@ -29,7 +29,10 @@ type Impression struct {
 	ID        uint      `gorm:"primaryKey"`
 	EventID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex"`
 	AdID      uint      `gorm:"not null;index"`
+	VariantID *uint     `gorm:"index"` // Creative served, for ads with variants
 	UserIP    string    `gorm:"size:45;not null"`
 	UserAgent string    `gorm:"type:text"`
+	VisitorID string    `gorm:"size:128;index"`
+	Placement string    `gorm:"size:100;index"`
 	CreatedAt time.Time `gorm:"autoCreateTime;index"`
 }
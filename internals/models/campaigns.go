@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Advertiser is a client whose campaigns we run.
+type Advertiser struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"size:255;not null" json:"name"`
+	ContactEmail string    `gorm:"size:255" json:"contact_email,omitempty"`
+	Status       string    `gorm:"size:50;not null;default:'active';index" json:"status"` // active, paused, archived
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Campaign groups an advertiser's ads under one flight and budget.
+type Campaign struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	AdvertiserID uint       `gorm:"not null;index" json:"advertiser_id"`
+	Advertiser   Advertiser `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Name         string     `gorm:"size:255;not null" json:"name"`
+	Status       string     `gorm:"size:50;not null;default:'active';index" json:"status"` // active, paused, archived
+	StartAt      *time.Time `json:"start_at,omitempty"`
+	EndAt        *time.Time `json:"end_at,omitempty"`
+	Schedule     string     `gorm:"size:500" json:"schedule,omitempty"`     // Day-parting for all its ads, e.g. mon-fri 9-17
+	Timezone     string     `gorm:"size:64" json:"timezone,omitempty"`      // IANA zone for Schedule, default UTC
+	Budget       float64    `gorm:"not null;default:0" json:"budget"`       // Lifetime budget; 0 is unlimited
+	DailyBudget  float64    `gorm:"not null;default:0" json:"daily_budget"` // Per UTC day; 0 is unlimited
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -7,13 +7,24 @@ import (
 )
 
 type Click struct {
-	ID              uint      `gorm:"primaryKey" json:"id"`
-	EventID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();not null;uniqueIndex" json:"event_id"` // Prevent duplicates, auto-generate
-	AdID            uint      `gorm:"not null;index" json:"ad_id"`
-	UserIP          string    `gorm:"size:45;not null" json:"user_ip"` // IPv4 & IPv6
-	UserAgent       string    `gorm:"type:text" json:"user_agent"`
-	PlaybackTimeSec float64   `json:"playback_time_sec"` // Video playback duration
-	WatchedPercent  float64   `json:"watched_percent"`   // % watched
-	IsFraudulent    bool      `gorm:"default:false" json:"is_fraudulent"`
-	CreatedAt       time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	EventID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();not null;uniqueIndex" json:"event_id"` // Prevent duplicates, auto-generate
+	AdID            uint       `gorm:"not null;index" json:"ad_id"`
+	ImpressionID    *uuid.UUID `gorm:"type:uuid;index" json:"impression_id,omitempty"` // From the click token, when signed
+	VariantID       *uint      `gorm:"index" json:"variant_id,omitempty"`              // Creative clicked, from the click token
+	UserIP          string     `gorm:"size:45;not null" json:"user_ip"`                // IPv4 & IPv6
+	UserAgent       string     `gorm:"type:text" json:"user_agent"`
+	VisitorID       string     `gorm:"size:128;index" json:"visitor_id"` // Client-provided cookie/device id
+	Fingerprint     string     `gorm:"size:64;index" json:"fingerprint"` // Salted hash of IP+UA
+	PlaybackTimeSec float64    `json:"playback_time_sec"`                // Video playback duration
+	WatchedPercent  float64    `json:"watched_percent"`                  // % watched
+	DeviceType      string     `gorm:"size:20;index" json:"device_type"` // desktop, mobile, tablet, tv, bot
+	Browser         string     `gorm:"size:50;index" json:"browser"`
+	OS              string     `gorm:"size:50;index" json:"os"`
+	Country         string     `gorm:"size:2;index" json:"country"` // ISO 3166-1 alpha-2
+	Region          string     `gorm:"size:10;index" json:"region"` // ISO 3166-2 subdivision
+	IsFraudulent    bool       `gorm:"default:false;index" json:"is_fraudulent"`
+	FraudScore      float64    `gorm:"not null;default:0" json:"fraud_score"`
+	FraudReasons    string     `gorm:"size:255" json:"fraud_reasons,omitempty"` // Comma-separated fraud.Reason* codes
+	CreatedAt       time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
 }
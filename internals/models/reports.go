@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportJob is an asynchronous analytics or clicks export. Params holds the
+// report's filters as a JSON object of analytics query parameters; relative
+// ranges such as time_window are resolved when the job runs.
+type ReportJob struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Type       string     `gorm:"size:20;not null" json:"type"`   // analytics, clicks
+	Format     string     `gorm:"size:20;not null" json:"format"` // csv, ndjson, parquet
+	Params     string     `gorm:"type:jsonb;not null;default:'{}'" json:"-"`
+	Status     string     `gorm:"size:20;not null;index" json:"status"` // queued, running, succeeded, failed
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	ResultKey  string     `gorm:"size:255" json:"-"` // Blob store key of the result
+	ResultSize int64      `json:"result_size,omitempty"`
+	RowCount   int64      `json:"row_count,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ReportSchedule generates a report on a cron schedule and delivers it to a
+// webhook. Type, Format and Params are as for ReportJob.
+type ReportSchedule struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name       string     `gorm:"size:255;not null" json:"name"`
+	Cron       string     `gorm:"size:100;not null" json:"cron"`                  // Standard 5-field cron expression
+	Timezone   string     `gorm:"size:64;not null;default:'UTC'" json:"timezone"` // IANA zone the cron expression is evaluated in
+	Type       string     `gorm:"size:20;not null" json:"type"`
+	Format     string     `gorm:"size:20;not null" json:"format"`
+	Params     string     `gorm:"type:jsonb;not null;default:'{}'" json:"-"`
+	WebhookURL string     `gorm:"size:2048;not null" json:"webhook_url"`
+	Secret     string     `gorm:"size:128;not null" json:"-"` // HMAC key for webhook signatures
+	Enabled    bool       `gorm:"not null;default:true" json:"enabled"`
+	NextRunAt  time.Time  `gorm:"not null;index" json:"next_run_at"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ReportDelivery is one run of a schedule: the generated report and its
+// webhook delivery attempts.
+type ReportDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ScheduleID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"schedule_id"`
+	ScheduledFor   time.Time  `gorm:"not null" json:"scheduled_for"`
+	Status         string     `gorm:"size:20;not null;index" json:"status"` // pending, sending, delivered, failed
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	ClaimedAt      *time.Time `json:"-"`                 // When a report worker started the current attempt
+	ResultKey      string     `gorm:"size:255" json:"-"` // Set once the report has been generated
+	RowCount       int64      `json:"row_count"`
+	ResultSize     int64      `json:"result_size"`
+	ResponseStatus int        `json:"response_status,omitempty"` // HTTP status of the last attempt
+	Error          string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
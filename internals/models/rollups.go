@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ClickRollup holds pre-aggregated click data for one ad in one hour. The
+// sketch columns are serialized sketch.HLL values, one per unique-user
+// identity strategy, so unique counts over any range of hours can be
+// estimated by merging rows instead of scanning clicks. PlaybackHistogram is
+// a sketch.Histogram over sketch.PlaybackBuckets and the Watched columns
+// count clicks that reached each quartile of the ad.
+type ClickRollup struct {
+	AdID              uint      `gorm:"primaryKey;autoIncrement:false" json:"ad_id"`
+	BucketStart       time.Time `gorm:"primaryKey;index" json:"bucket_start"` // Truncated to the hour, UTC
+	Clicks            int64     `gorm:"not null;default:0" json:"clicks"`
+	IPSketch          []byte    `gorm:"type:bytea" json:"-"`
+	FingerprintSketch []byte    `gorm:"type:bytea" json:"-"`
+	VisitorSketch     []byte    `gorm:"type:bytea" json:"-"`
+	PlaybackHistogram []byte    `gorm:"type:bytea" json:"-"`
+	Watched25         int64     `gorm:"not null;default:0" json:"watched_25"`
+	Watched50         int64     `gorm:"not null;default:0" json:"watched_50"`
+	Watched75         int64     `gorm:"not null;default:0" json:"watched_75"`
+	Watched100        int64     `gorm:"not null;default:0" json:"watched_100"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AdSpend is an ad's spend on one UTC day. CampaignID is the campaign the
+// ad was in when the spend was last recorded, so campaign budgets keep
+// counting it if the ad is moved.
+type AdSpend struct {
+	AdID       uint      `gorm:"primaryKey;autoIncrement:false" json:"ad_id"`
+	Day        time.Time `gorm:"primaryKey;type:date;index" json:"day"`
+	CampaignID *uint     `gorm:"index" json:"campaign_id,omitempty"`
+	Spend      float64   `gorm:"not null;default:0" json:"spend"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ServingRollup counts ad serving outcomes for one ad in one hour.
+// CappedRequests counts requests the ad matched but was withheld from
+// because the viewer had reached its frequency cap.
+type ServingRollup struct {
+	AdID           uint      `gorm:"primaryKey;autoIncrement:false" json:"ad_id"`
+	BucketStart    time.Time `gorm:"primaryKey;index" json:"bucket_start"` // Truncated to the hour, UTC
+	CappedRequests int64     `gorm:"not null;default:0" json:"capped_requests"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
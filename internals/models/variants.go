@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AdVariant is one of the creatives of an ad being tested against each
+// other. Active variants split the ad's traffic in proportion to Weight.
+type AdVariant struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AdID      uint      `gorm:"not null;index" json:"ad_id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Title     string    `gorm:"size:255" json:"title,omitempty"`      // Overrides the ad's title when set
+	ImageURL  string    `gorm:"size:500;not null" json:"image_url"`   // The creative
+	TargetURL string    `gorm:"size:500" json:"target_url,omitempty"` // Overrides the ad's landing page when set
+	Weight    int       `gorm:"not null;default:1" json:"weight"`
+	Status    string    `gorm:"size:50;not null;default:'active';index" json:"status"` // active, paused
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -18,8 +18,131 @@ var reqDuration = prometheus.NewHistogramVec(
 	[]string{"method", "path", "status"},
 )
 
+// Analytics cache metrics
+var (
+	AnalyticsCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "analytics_cache_hits_total",
+		Help: "Analytics queries served from cache",
+	})
+	AnalyticsCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "analytics_cache_misses_total",
+		Help: "Analytics cache lookups that found no fresh entry",
+	})
+	AnalyticsCacheEvictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_cache_evictions_total",
+			Help: "Analytics cache entries evicted, by reason (capacity, expired)",
+		},
+		[]string{"reason"},
+	)
+	AnalyticsCacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "analytics_cache_entries",
+		Help: "Entries currently held in the analytics cache",
+	})
+	AnalyticsCoalescedRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "analytics_coalesced_requests_total",
+		Help: "Analytics queries answered by an identical query already in flight",
+	})
+	AnalyticsStaleRevalidations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "analytics_stale_revalidations_total",
+		Help: "Background refreshes started after serving a stale analytics page",
+	})
+)
+
+// Live analytics metrics
+var (
+	LiveSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "live_analytics_subscribers",
+		Help: "Connected SSE/WebSocket live analytics clients",
+	})
+	LiveEventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "live_analytics_events_dropped_total",
+		Help: "Click events dropped for live subscribers that fell behind",
+	})
+)
+
+// Report job metrics
+var (
+	ReportJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_jobs_total",
+		Help: "Finished report jobs by outcome",
+	}, []string{"status"})
+	ReportJobDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "report_job_duration_seconds",
+		Help:    "Time taken to generate a report",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12), // 1s to ~34m
+	})
+	ReportDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_deliveries_total",
+		Help: "Scheduled report webhook attempts by outcome (delivered, retry, failed)",
+	}, []string{"outcome"})
+)
+
+// Fraud detection metrics
+var (
+	FraudSignals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fraud_signals_total",
+		Help: "Fraud rule hits by reason code",
+	}, []string{"reason"})
+	FraudulentClicks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fraudulent_clicks_total",
+		Help: "Clicks flagged as fraudulent",
+	})
+)
+
+// Ad serving metrics
+var (
+	AdRequestsCapped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ad_requests_capped_total",
+		Help: "Ad requests left unfilled because every matching ad was frequency capped",
+	})
+	AdsCapped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ad_frequency_caps_applied_total",
+		Help: "Matching ads withheld from a request by their frequency cap",
+	})
+	AdsPaced = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ad_pacing_holds_total",
+		Help: "Matching ads withheld from a request because they were ahead of their daily budget pace",
+	})
+)
+
+// Budget metrics
+var (
+	AdSpend = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ad_spend_total",
+		Help: "Spend recorded on clicks and impressions, in budget currency units",
+	}, []string{"pricing_model"})
+	AdsBudgetPaused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ads_budget_paused_total",
+		Help: "Ads paused automatically because a budget was spent",
+	}, []string{"reason"})
+)
+
+// Flight metrics
+var (
+	AdFlightTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ad_flight_transitions_total",
+		Help: "Ads paused or resumed by the flight scheduler, by new status",
+	}, []string{"status"})
+)
+
+// Rate limiting metrics
+var RateLimitedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limited_requests_total",
+	Help: "Requests rejected with 429, by route and the limit they exceeded",
+}, []string{"path", "limit"})
+
 func init() {
 	prometheus.MustRegister(reqDuration)
+	prometheus.MustRegister(AnalyticsCacheHits, AnalyticsCacheMisses, AnalyticsCacheEvictions, AnalyticsCacheEntries)
+	prometheus.MustRegister(AnalyticsCoalescedRequests, AnalyticsStaleRevalidations)
+	prometheus.MustRegister(LiveSubscribers, LiveEventsDropped)
+	prometheus.MustRegister(ReportJobs, ReportJobDuration, ReportDeliveries)
+	prometheus.MustRegister(FraudSignals, FraudulentClicks)
+	prometheus.MustRegister(RateLimitedRequests)
+	prometheus.MustRegister(AdRequestsCapped, AdsCapped, AdsPaced)
+	prometheus.MustRegister(AdSpend, AdsBudgetPaused)
+	prometheus.MustRegister(AdFlightTransitions)
 }
 
 // WrapH style middleware for Gin
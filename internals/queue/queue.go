@@ -16,13 +16,18 @@ import (
 
 // ClickEvent is the payload for click tracking.
 type ClickEvent struct {
-	EventID   uuid.UUID `json:"event_id"`
-	AdID      uint      `json:"ad_id"`
-	UserIP    string    `json:"user_ip"`
-	Agent     string    `json:"agent"`
-	PlayTime  float64   `json:"play_time_secs"`
-	Watched   float64   `json:"watched_percent"`
-	Timestamp int64     `json:"timestamp"`
+	EventID      uuid.UUID  `json:"event_id"`
+	AdID         uint       `json:"ad_id"`
+	ImpressionID *uuid.UUID `json:"impression_id,omitempty"`
+	VariantID    *uint      `json:"variant_id,omitempty"`
+	UserIP       string     `json:"user_ip"`
+	Agent        string     `json:"agent"`
+	VisitorID    string     `json:"visitor_id,omitempty"`
+	Fingerprint  string     `json:"fingerprint,omitempty"`
+	PlayTime     float64    `json:"play_time_secs"`
+	Watched      float64    `json:"watched_percent"`
+	Timestamp    int64      `json:"timestamp"`             // Client-reported, unverified
+	ReceivedAt   int64      `json:"received_at,omitempty"` // Unix milliseconds when the API accepted the click
 }
 
 // Producer wraps Kafka writer for publishing events.
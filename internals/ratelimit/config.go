@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/db"
+)
+
+// NewStoreFromConfig returns the bucket store selected in cfg.
+func NewStoreFromConfig(cfg *config.Config) Store {
+	if cfg.RateLimitBackend == "redis" {
+		return NewRedisStore(db.Redis)
+	}
+	return NewMemoryStore()
+}
+
+// ClickRules returns the click ingestion limits configured in cfg. adKey
+// finds the clicked ad, which routes carry in different places.
+func ClickRules(cfg *config.Config, adKey KeyFunc) []Rule {
+	return []Rule{
+		{Name: "ip", Limit: Limit{PerMinute: cfg.RateLimitIPPerMinute, Burst: cfg.RateLimitIPBurst}, Key: ByClientIP},
+		{Name: "ip_ad", Limit: Limit{PerMinute: cfg.RateLimitIPAdPerMinute, Burst: cfg.RateLimitIPAdBurst}, Key: adKey},
+		{Name: "api_key", Limit: Limit{PerMinute: cfg.RateLimitAPIKeyPerMinute, Burst: cfg.RateLimitAPIKeyBurst}, Key: ByAPIKey(cfg.RateLimitAPIKeys)},
+	}
+}
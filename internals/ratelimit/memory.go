@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many takes pass between sweeps of full buckets.
+const sweepEvery = 10000
+
+// MemoryStore keeps buckets local to one replica, so each replica allows
+// the full limit on its own.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Duration // Time to refill from empty; idle buckets past it are dropped
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, buckets []Bucket) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.takes++; s.takes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	refilled := make([]*bucket, len(buckets))
+	for i, spec := range buckets {
+		b := s.refill(spec, now)
+		if b.tokens < 1 {
+			return Result{Denied: i, RetryAfter: time.Duration((1 - b.tokens) * float64(spec.Limit.interval()))}, nil
+		}
+		refilled[i] = b
+	}
+	for _, b := range refilled {
+		b.tokens--
+	}
+	return Result{Allowed: true}, nil
+}
+
+// refill returns spec's bucket, created full if missing and topped up for
+// the time since it was last touched; callers must hold s.mu.
+func (s *MemoryStore) refill(spec Bucket, now time.Time) *bucket {
+	burst := float64(spec.Limit.burst())
+	interval := spec.Limit.interval()
+
+	b, ok := s.buckets[spec.Key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		s.buckets[spec.Key] = b
+	}
+	b.full = time.Duration(burst) * interval
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(burst, b.tokens+float64(elapsed)/float64(interval))
+		b.updated = now
+	}
+	return b
+}
+
+// sweep drops buckets that have refilled completely, which behave the
+// same as missing ones; callers must hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.full {
+			delete(s.buckets, key)
+		}
+	}
+}
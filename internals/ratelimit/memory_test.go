@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryStoreTakesAllOrNothing(t *testing.T) {
+	store := NewMemoryStore()
+	ip := Bucket{Key: "ip:10.0.0.1", Limit: Limit{PerMinute: 1, Burst: 3}}
+	perAd := func(key string) Bucket {
+		return Bucket{Key: key, Limit: Limit{PerMinute: 1, Burst: 1}}
+	}
+
+	// The IP allows three requests. The second one on ad:1 is refused by
+	// its ad bucket and must not use up one of them.
+	for i, step := range []struct {
+		buckets []Bucket
+		allowed bool
+		denied  int
+	}{
+		{[]Bucket{ip, perAd("ad:1")}, true, 0},
+		{[]Bucket{ip, perAd("ad:1")}, false, 1},
+		{[]Bucket{ip, perAd("ad:2")}, true, 0},
+		{[]Bucket{ip, perAd("ad:3")}, true, 0},
+		{[]Bucket{ip, perAd("ad:4")}, false, 0},
+		{[]Bucket{perAd("ad:4")}, true, 0},
+	} {
+		result, err := store.Take(context.Background(), step.buckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != step.allowed || (!step.allowed && result.Denied != step.denied) {
+			t.Fatalf("take %d: allowed %t denied %d, want allowed %t denied %d",
+				i+1, result.Allowed, result.Denied, step.allowed, step.denied)
+		}
+		if !result.Allowed && result.RetryAfter <= 0 {
+			t.Fatalf("take %d: denied without Retry-After", i+1)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/tracking"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader carries the API key requests are limited by.
+const APIKeyHeader = "X-API-Key"
+
+// maxPeekedBody bounds how much of a request body is read to find its ad.
+const maxPeekedBody = 64 << 10
+
+// KeyFunc returns the bucket a request is counted against, or "" if the
+// rule does not apply to it.
+type KeyFunc func(c *gin.Context) string
+
+// Rule limits requests sharing a key. Name labels the rule in metrics and
+// 429 responses.
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   KeyFunc
+}
+
+// ByClientIP counts requests per client IP.
+func ByClientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByClientIPAndAd counts requests per client IP and the ad_id in the JSON
+// body, so one client cannot inflate a single ad. Requests without an ad
+// are left to the handler to reject.
+func ByClientIPAndAd(c *gin.Context) string {
+	adID, ok := peekAdID(c)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("ad:%d:%s", adID, c.ClientIP())
+}
+
+// ByClientIPAndTokenAd counts /c/:token requests like ByClientIPAndAd,
+// taking the ad from the signed token in the path. Requests with an invalid
+// token are left to the handler to reject.
+func ByClientIPAndTokenAd(signer *tracking.Signer) KeyFunc {
+	return func(c *gin.Context) string {
+		token, err := signer.Verify(c.Param("token"))
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("ad:%d:%s", token.AdID, c.ClientIP())
+	}
+}
+
+// ByAPIKey counts requests per API key sent in APIKeyHeader, if it is one
+// of keys. Other values are ignored, so a client cannot get a fresh bucket
+// by sending a new one. Keys are hashed so they are not stored in the clear.
+func ByAPIKey(keys []string) KeyFunc {
+	known := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		known[hashAPIKey(key)] = struct{}{}
+	}
+
+	return func(c *gin.Context) string {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			return ""
+		}
+		hashed := hashAPIKey(key)
+		if _, ok := known[hashed]; !ok {
+			return ""
+		}
+		return "key:" + hashed
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// peekAdID reads ad_id from the JSON body and restores the body for the
+// handler.
+func peekAdID(c *gin.Context) (uint, bool) {
+	if c.Request.Body == nil {
+		return 0, false
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedBody))
+	if err != nil {
+		return 0, false
+	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+	var payload struct {
+		AdID uint `json:"ad_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.AdID == 0 {
+		return 0, false
+	}
+	return payload.AdID, true
+}
+
+// Middleware rejects requests exceeding any of the rules with 429 and a
+// Retry-After header. Tokens are only taken when every rule allows the
+// request, so a rejected request does not use up the other rules' buckets.
+// Rules with a disabled limit are skipped. If the store fails, requests are
+// let through rather than failing ingestion.
+func Middleware(store Store, rules ...Rule) gin.HandlerFunc {
+	active := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Limit.Enabled() {
+			active = append(active, rule)
+		}
+	}
+
+	return func(c *gin.Context) {
+		buckets := make([]Bucket, 0, len(active))
+		names := make([]string, 0, len(active))
+		for _, rule := range active {
+			if key := rule.Key(c); key != "" {
+				buckets = append(buckets, Bucket{Key: key, Limit: rule.Limit})
+				names = append(names, rule.Name)
+			}
+		}
+		if len(buckets) == 0 {
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(c.Request.Context(), buckets)
+		if err != nil {
+			observability.Logger.Warn("Rate limit check failed, allowing request", zap.Error(err))
+			c.Next()
+			return
+		}
+		if result.Allowed {
+			c.Next()
+			return
+		}
+
+		name := names[result.Denied]
+		observability.RateLimitedRequests.WithLabelValues(c.FullPath(), name).Inc()
+		retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "Rate limit exceeded",
+			"limit": name,
+		})
+	}
+}
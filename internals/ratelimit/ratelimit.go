@@ -0,0 +1,54 @@
+// Package ratelimit throttles requests with token buckets, held in memory
+// or in a Redis-protocol server shared by all replicas.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests may be made at once, refilled
+// at PerMinute requests per minute.
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Enabled reports whether the limit allows any requests at all; a zero
+// limit disables throttling rather than blocking everything.
+func (l Limit) Enabled() bool {
+	return l.PerMinute > 0
+}
+
+// burst returns the bucket size, defaulting to a full minute's allowance.
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.PerMinute
+}
+
+// interval is the time it takes to refill one token.
+func (l Limit) interval() time.Duration {
+	return time.Minute / time.Duration(l.PerMinute)
+}
+
+// Bucket is a token bucket a request takes from.
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Result is the outcome of taking tokens.
+type Result struct {
+	Allowed    bool
+	Denied     int           // Index of the first bucket without a token, when not allowed
+	RetryAfter time.Duration // Until that bucket has a token again
+}
+
+// Store holds token buckets by key. Take removes a token from each of the
+// buckets if every one has a token available, and otherwise takes none, so
+// a request refused by one bucket does not use up the others.
+type Store interface {
+	Take(ctx context.Context, buckets []Bucket) (Result, error)
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "lvstage:ratelimit:"
+
+// takeScript refills a request's buckets and takes a token from each, only
+// if all of them have one, atomically. Each bucket is a hash of its token
+// count and last update in milliseconds, and expires once it would have
+// refilled completely.
+//
+// KEYS: buckets; ARGV: now (ms), then per bucket its refill interval (ms
+// per token) and burst. Returns {allowed, index of the denying bucket
+// (1-based, 0 if allowed), retry after (ms)}.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local tokens = {}
+
+for i, key in ipairs(KEYS) do
+	local interval = tonumber(ARGV[2 * i])
+	local burst = tonumber(ARGV[2 * i + 1])
+
+	local state = redis.call("HMGET", key, "tokens", "updated")
+	local available = tonumber(state[1])
+	local updated = tonumber(state[2])
+	if available == nil or updated == nil then
+		available = burst
+		updated = now
+	end
+	if now > updated then
+		available = math.min(burst, available + (now - updated) / interval)
+	end
+
+	if available < 1 then
+		return {0, i, math.ceil((1 - available) * interval)}
+	end
+	tokens[i] = available
+end
+
+for i, key in ipairs(KEYS) do
+	local interval = tonumber(ARGV[2 * i])
+	local burst = tonumber(ARGV[2 * i + 1])
+	redis.call("HSET", key, "tokens", tostring(tokens[i] - 1), "updated", tostring(now))
+	redis.call("PEXPIRE", key, math.ceil(burst * interval))
+end
+return {1, 0, 0}
+`)
+
+// RedisStore keeps buckets in a Redis-protocol server so that limits
+// apply across all replicas. Bucket clocks come from the replicas, which
+// are assumed to be roughly in sync.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Take(ctx context.Context, buckets []Bucket) (Result, error) {
+	keys := make([]string, len(buckets))
+	args := make([]interface{}, 0, 1+2*len(buckets))
+	args = append(args, time.Now().UnixMilli())
+	for i, bucket := range buckets {
+		keys[i] = redisKeyPrefix + bucket.Key
+		interval := float64(bucket.Limit.interval()) / float64(time.Millisecond)
+		args = append(args, interval, bucket.Limit.burst())
+	}
+
+	values, err := takeScript.Run(ctx, s.client, keys, args...).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if values[0] == 1 {
+		return Result{Allowed: true}, nil
+	}
+	return Result{
+		Denied:     int(values[1]) - 1,
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
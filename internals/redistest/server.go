@@ -0,0 +1,371 @@
+// Package redistest runs an in-process stand-in for a Redis server, so
+// Redis-backed components can be tested without one. It speaks RESP2 and
+// implements the handful of commands those components use.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Server is a single-database key/value store with expiry. Time only moves
+// through FastForward, so tests control when keys expire.
+type Server struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	now  time.Time
+	data map[string]entry
+	// conns are closed with the server so clients see it go away
+	conns map[net.Conn]struct{}
+}
+
+type entry struct {
+	value    string
+	expireAt time.Time // Zero when the key does not expire
+}
+
+// NewServer starts a server on a loopback port and stops it when t ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("redistest: listen: %v", err)
+	}
+	s := &Server{
+		listener: listener,
+		now:      time.Now(),
+		data:     make(map[string]entry),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr is the address clients connect to.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// NewClient returns a client of s that is closed when t ends.
+func (s *Server) NewClient(t testing.TB) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Close stops the server and drops its connections.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// FastForward advances the server's clock by d, expiring keys as it goes.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// Get returns the value of key, if it is set and has not expired.
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(key)
+	return e.value, ok
+}
+
+// TTL returns how long key has left, or zero if it does not expire.
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(key)
+	if !ok || e.expireAt.IsZero() {
+		return 0
+	}
+	return e.expireAt.Sub(s.now)
+}
+
+// Set stores value under key without expiry.
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = entry{value: value}
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		reply := s.exec(args)
+		s.mu.Unlock()
+
+		writeReply(w, reply)
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Replies are written by type: string is a bulk string, nil a null bulk
+// string, int64 an integer, status a simple string and error an error.
+type status string
+
+var errSyntax = errors.New("ERR syntax error")
+
+func (s *Server) exec(args []string) any {
+	if len(args) == 0 {
+		return errors.New("ERR empty command")
+	}
+
+	name, args := strings.ToUpper(args[0]), args[1:]
+	switch name {
+	case "PING":
+		return status("PONG")
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		if e, ok := s.lookup(args[0]); ok {
+			return e.value
+		}
+		return nil
+	case "SET":
+		return s.set(args)
+	case "DEL":
+		var deleted int64
+		for _, key := range args {
+			if _, ok := s.lookup(key); ok {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		return deleted
+	case "PEXPIRE":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New("ERR value is not an integer or out of range")
+		}
+		e, ok := s.lookup(args[0])
+		if !ok {
+			return int64(0)
+		}
+		e.expireAt = s.now.Add(time.Duration(ms) * time.Millisecond)
+		s.data[args[0]] = e
+		return int64(1)
+	case "EVAL":
+		return s.eval(args)
+	case "EVALSHA":
+		// Scripts are never cached, so clients fall back to EVAL
+		return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return fmt.Errorf("ERR unknown command '%s'", strings.ToLower(name))
+}
+
+func wrongArgs(name string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+// lookup returns key's entry, dropping it if it has expired.
+func (s *Server) lookup(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expireAt.IsZero() && !s.now.Before(e.expireAt) {
+		delete(s.data, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+// set implements SET key value [EX seconds | PX milliseconds] [NX | XX].
+func (s *Server) set(args []string) any {
+	if len(args) < 2 {
+		return wrongArgs("SET")
+	}
+
+	key, e := args[0], entry{value: args[1]}
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errors.New("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			e.expireAt = s.now.Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errSyntax
+		}
+	}
+
+	_, exists := s.lookup(key)
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.data[key] = e
+	return status("OK")
+}
+
+// guardedScript matches the one shape of Lua script the stand-in runs: a
+// command applied only while KEYS[1] holds ARGV[1], as used for leases.
+var guardedScript = regexp.MustCompile(`^\s*if redis\.call\("GET", KEYS\[1\]\) == ARGV\[1\] then\s+return redis\.call\("(\w+)"((?:, (?:KEYS|ARGV)\[\d+\])*)\)\s+end\s+return 0\s*$`)
+
+var scriptArg = regexp.MustCompile(`(KEYS|ARGV)\[(\d+)\]`)
+
+// eval implements EVAL script numkeys key... arg... for guardedScript.
+func (s *Server) eval(args []string) any {
+	if len(args) < 2 {
+		return wrongArgs("EVAL")
+	}
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	keys, argv := args[2:2+numKeys], args[2+numKeys:]
+
+	m := guardedScript.FindStringSubmatch(args[0])
+	if m == nil {
+		return errors.New("ERR redistest only runs guarded single-command scripts")
+	}
+	if len(keys) < 1 || len(argv) < 1 {
+		return errors.New("ERR script needs KEYS[1] and ARGV[1]")
+	}
+	if e, ok := s.lookup(keys[0]); !ok || e.value != argv[0] {
+		return int64(0)
+	}
+
+	call := []string{m[1]}
+	for _, ref := range scriptArg.FindAllStringSubmatch(m[2], -1) {
+		i, _ := strconv.Atoi(ref[2])
+		from := keys
+		if ref[1] == "ARGV" {
+			from = argv
+		}
+		if i < 1 || i > len(from) {
+			return fmt.Errorf("ERR script references missing %s[%d]", ref[1], i)
+		}
+		call = append(call, from[i-1])
+	}
+	return s.exec(call)
+}
+
+// readCommand reads one command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, fmt.Errorf("redistest: expected array, got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("redistest: expected bulk string, got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	}
+}
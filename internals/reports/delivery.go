@@ -0,0 +1,266 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	webhookTimeout = 30 * time.Second
+	// maxDeliveryAttempts bounds webhook retries; the delay doubles from
+	// deliveryRetryBase after each failed attempt.
+	maxDeliveryAttempts = 6
+	deliveryRetryBase   = time.Minute
+	// Signature headers sent with each webhook
+	signatureHeader  = "X-Lvstage-Signature"
+	scheduleIDHeader = "X-Lvstage-Schedule-ID"
+	deliveryIDHeader = "X-Lvstage-Delivery-ID"
+)
+
+// deliverer generates scheduled reports and posts them to their webhooks.
+// Pool workers claim due deliveries from report_deliveries with SKIP
+// LOCKED, so each attempt is made by one worker on one replica.
+type deliverer struct {
+	service    *Service
+	client     *http.Client
+	jobTimeout time.Duration
+}
+
+func newDeliverer(service *Service, jobTimeout time.Duration) *deliverer {
+	return &deliverer{
+		service:    service,
+		client:     newWebhookClient(),
+		jobTimeout: jobTimeout,
+	}
+}
+
+// staleAfter is how long an attempt may run before it is assumed abandoned.
+func (d *deliverer) staleAfter() time.Duration {
+	return d.jobTimeout + webhookTimeout + time.Minute
+}
+
+// claim marks the delivery due longest as sending, counting the attempt,
+// and returns it, or nil if none is due. Attempts abandoned by a stopped
+// worker are retried like failed ones, and failed once they are used up.
+func (d *deliverer) claim(ctx context.Context) (*models.ReportDelivery, error) {
+	staleBefore := time.Now().Add(-d.staleAfter())
+	db := d.service.DB.WithContext(ctx)
+
+	if err := db.Model(&models.ReportDelivery{}).
+		Where("status = ? AND claimed_at < ? AND attempts >= ?", DeliverySending, staleBefore, maxDeliveryAttempts).
+		Updates(map[string]interface{}{
+			"status": DeliveryFailed,
+			"error":  "report worker stopped before finishing",
+		}).Error; err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.ReportDelivery
+	err := db.Raw(`
+		UPDATE report_deliveries
+		SET status = ?, attempts = attempts + 1, claimed_at = NOW()
+		WHERE id = (
+			SELECT id FROM report_deliveries
+			WHERE (status = ? AND next_attempt_at <= NOW()) OR (status = ? AND claimed_at < ?)
+			ORDER BY next_attempt_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		DeliverySending, DeliveryPending, DeliverySending, staleBefore).
+		Scan(&deliveries).Error
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+// attempt generates a claimed delivery's report if needed and posts it to
+// the schedule's webhook, recording the outcome and when to retry. An
+// attempt interrupted by the end of workerCtx, or whose schedule cannot be
+// read, is handed back uncounted.
+func (d *deliverer) attempt(workerCtx context.Context, delivery *models.ReportDelivery) {
+	log := observability.Logger.With(
+		zap.String("schedule_id", delivery.ScheduleID.String()),
+		zap.String("delivery_id", delivery.ID.String()),
+		zap.Int("attempt", delivery.Attempts))
+
+	// Outcomes are recorded even if the worker is stopping
+	recordCtx := context.WithoutCancel(workerCtx)
+
+	schedule, err := d.service.GetSchedule(workerCtx, delivery.ScheduleID)
+	switch {
+	case err == nil:
+	case workerCtx.Err() != nil:
+		d.requeue(recordCtx, log, delivery, nil, delivery.NextAttemptAt)
+		return
+	case errors.Is(err, errScheduleNotFound):
+		log.Warn("Dropping delivery for missing schedule", zap.Error(err))
+		d.record(recordCtx, log, delivery, map[string]interface{}{
+			"status": DeliveryFailed,
+			"error":  err.Error(),
+		})
+		return
+	default:
+		// The schedule could not be read for now; retrying does not use
+		// up an attempt, since the webhook was never called
+		log.Warn("Failed to load schedule for delivery", zap.Error(err))
+		d.requeue(recordCtx, log, delivery, map[string]interface{}{"error": err.Error()}, time.Now().Add(deliveryRetryBase))
+		return
+	}
+
+	updates := make(map[string]interface{})
+
+	// The report is generated once, so retries resend identical content
+	if delivery.ResultKey == "" {
+		genCtx, cancel := context.WithTimeout(workerCtx, d.jobTimeout)
+		params, err := jobParams(schedule.Params)
+		if err == nil {
+			key := fmt.Sprintf("deliveries/%s.%s", delivery.ID, schedule.Format)
+			delivery.ResultSize, delivery.RowCount, err = d.service.generate(genCtx, schedule.Type, schedule.Format, params, key)
+			if err == nil {
+				delivery.ResultKey = key
+				updates["result_key"] = key
+				updates["result_size"] = delivery.ResultSize
+				updates["row_count"] = delivery.RowCount
+			}
+		}
+		cancel()
+		if err != nil {
+			if workerCtx.Err() != nil {
+				d.requeue(recordCtx, log, delivery, updates, delivery.NextAttemptAt)
+				return
+			}
+			d.recordFailure(recordCtx, log, delivery, updates, 0, fmt.Errorf("generate report: %w", err))
+			return
+		}
+	}
+
+	status, err := d.post(workerCtx, schedule, delivery)
+	if err != nil {
+		if workerCtx.Err() != nil {
+			d.requeue(recordCtx, log, delivery, updates, delivery.NextAttemptAt)
+			return
+		}
+		d.recordFailure(recordCtx, log, delivery, updates, status, err)
+		return
+	}
+
+	updates["status"] = DeliveryDelivered
+	updates["response_status"] = status
+	updates["error"] = ""
+	updates["delivered_at"] = time.Now()
+	d.record(recordCtx, log, delivery, updates)
+	observability.ReportDeliveries.WithLabelValues(DeliveryDelivered).Inc()
+	log.Info("Scheduled report delivered", zap.Int("response_status", status))
+}
+
+// recordFailure schedules a retry with exponential backoff, or fails the
+// delivery once attempts are used up.
+func (d *deliverer) recordFailure(ctx context.Context, log *zap.Logger, delivery *models.ReportDelivery, updates map[string]interface{}, status int, err error) {
+	updates["error"] = err.Error()
+	updates["response_status"] = status
+
+	outcome := "retry"
+	if retryAt, ok := nextDeliveryAttempt(delivery.Attempts, time.Now()); ok {
+		updates["status"] = DeliveryPending
+		updates["next_attempt_at"] = retryAt
+		log.Warn("Scheduled report delivery failed, will retry", zap.Error(err), zap.Time("retry_at", retryAt))
+	} else {
+		outcome = DeliveryFailed
+		updates["status"] = DeliveryFailed
+		log.Error("Scheduled report delivery failed", zap.Error(err))
+	}
+	observability.ReportDeliveries.WithLabelValues(outcome).Inc()
+
+	d.record(ctx, log, delivery, updates)
+}
+
+// requeue hands an interrupted attempt back as pending from retryAt without
+// counting it, keeping a report that was already generated.
+func (d *deliverer) requeue(ctx context.Context, log *zap.Logger, delivery *models.ReportDelivery, updates map[string]interface{}, retryAt time.Time) {
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["status"] = DeliveryPending
+	updates["attempts"] = gorm.Expr("attempts - 1")
+	updates["next_attempt_at"] = retryAt
+	d.record(ctx, log, delivery, updates)
+	log.Info("Scheduled report delivery requeued", zap.Time("retry_at", retryAt))
+}
+
+// record applies updates to a delivery this worker still holds. Once the
+// delivery is settled its report is no longer needed and is deleted.
+func (d *deliverer) record(ctx context.Context, log *zap.Logger, delivery *models.ReportDelivery, updates map[string]interface{}) {
+	result := d.service.DB.WithContext(ctx).
+		Model(delivery).
+		Where("status = ? AND attempts = ?", DeliverySending, delivery.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		log.Error("Failed to record report delivery", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		log.Warn("Report delivery was reclaimed before its outcome was recorded")
+		return
+	}
+
+	if status := updates["status"]; (status == DeliveryDelivered || status == DeliveryFailed) && delivery.ResultKey != "" {
+		if err := d.service.store.Delete(ctx, delivery.ResultKey); err != nil {
+			log.Warn("Failed to delete delivered report", zap.Error(err))
+		}
+	}
+}
+
+// post sends the report to the webhook, signed with the schedule's secret.
+func (d *deliverer) post(ctx context.Context, schedule *models.ReportSchedule, delivery *models.ReportDelivery) (int, error) {
+	result, _, err := d.service.store.Open(ctx, delivery.ResultKey)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := signWebhook(schedule.Secret, time.Now(), result)
+	result.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	body, size, err := d.service.store.Open(ctx, delivery.ResultKey)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, schedule.WebhookURL, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", analytics.ExportContentType(schedule.Format))
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("%s_%s.%s", schedule.Type, delivery.ScheduledFor.UTC().Format("20060102T150405Z"), schedule.Format)))
+	req.Header.Set(signatureHeader, signature)
+	req.Header.Set(scheduleIDHeader, schedule.ID.String())
+	req.Header.Set(deliveryIDHeader, delivery.ID.String())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,259 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	pollInterval = 5 * time.Second
+	// maxAttempts bounds how often a job is picked up again after the
+	// replica running it stopped without finishing it.
+	maxAttempts = 3
+	// Finished jobs past their retention are deleted in batches of
+	// expireBatch every expireInterval.
+	expireInterval = time.Hour
+	expireBatch    = 100
+)
+
+// Pool runs queued report jobs and scheduled report deliveries with a fixed
+// number of workers. Jobs are claimed from report_jobs with SKIP LOCKED, so
+// pools on several replicas share one queue and a job abandoned by a dead
+// replica is picked up again once it has been running for longer than the
+// job timeout; deliveries are claimed the same way. Finished jobs and their
+// results are deleted once they are older than retention.
+type Pool struct {
+	service    *Service
+	workers    int
+	jobTimeout time.Duration
+	retention  time.Duration
+	deliverer  *deliverer
+}
+
+func NewPool(service *Service, workers int, jobTimeout, retention time.Duration) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{
+		service:    service,
+		workers:    workers,
+		jobTimeout: jobTimeout,
+		retention:  retention,
+		deliverer:  newDeliverer(service, jobTimeout),
+	}
+}
+
+// Run starts the workers and blocks until ctx is done and they have
+// returned. Jobs interrupted by ctx are put back in the queue.
+func (p *Pool) Run(ctx context.Context) {
+	observability.Logger.Info("Report worker pool started", zap.Int("workers", p.workers))
+
+	done := make(chan struct{})
+	for range p.workers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			p.work(ctx)
+		}()
+	}
+	p.expire(ctx)
+	for range p.workers {
+		<-done
+	}
+}
+
+// expire deletes finished jobs past their retention until ctx is done.
+func (p *Pool) expire(ctx context.Context) {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			deleted, err := p.service.DeleteExpired(ctx, time.Now().Add(-p.retention), expireBatch)
+			if err != nil {
+				observability.Logger.Error("Failed to delete expired report jobs", zap.Error(err))
+				break
+			}
+			if deleted > 0 {
+				observability.Logger.Info("Deleted expired report jobs", zap.Int("jobs", deleted))
+			}
+			if deleted < expireBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting again
+		for ctx.Err() == nil && p.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.service.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext runs one queued job or, if there is none, one due scheduled
+// report delivery. It reports whether there was anything to run.
+func (p *Pool) runNext(ctx context.Context) bool {
+	job, err := p.claim(ctx)
+	if err != nil {
+		observability.Logger.Error("Failed to claim report job", zap.Error(err))
+		return false
+	}
+	if job != nil {
+		p.execute(ctx, job)
+		return true
+	}
+
+	delivery, err := p.deliverer.claim(ctx)
+	if err != nil {
+		observability.Logger.Error("Failed to claim report delivery", zap.Error(err))
+		return false
+	}
+	if delivery != nil {
+		p.deliverer.attempt(ctx, delivery)
+		return true
+	}
+	return false
+}
+
+// claim marks the oldest runnable job as running and returns it, or nil if
+// there is none. Jobs left running past the job timeout are retried until
+// they have used up maxAttempts, then failed.
+func (p *Pool) claim(ctx context.Context) (*models.ReportJob, error) {
+	staleBefore := time.Now().Add(-p.staleAfter())
+	db := p.service.DB.WithContext(ctx)
+
+	if err := db.Model(&models.ReportJob{}).
+		Where("status = ? AND started_at < ? AND attempts >= ?", StatusRunning, staleBefore, maxAttempts).
+		Updates(map[string]interface{}{
+			"status":      StatusFailed,
+			"error":       "report worker stopped before finishing",
+			"finished_at": time.Now(),
+		}).Error; err != nil {
+		return nil, err
+	}
+
+	var jobs []models.ReportJob
+	err := db.Raw(`
+		UPDATE report_jobs
+		SET status = ?, attempts = attempts + 1, started_at = NOW(), error = ''
+		WHERE id = (
+			SELECT id FROM report_jobs
+			WHERE status = ? OR (status = ? AND started_at < ?)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		StatusRunning, StatusQueued, StatusRunning, staleBefore).
+		Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// staleAfter is how long a job may run before it is assumed abandoned.
+func (p *Pool) staleAfter() time.Duration {
+	return p.jobTimeout + time.Minute
+}
+
+func (p *Pool) execute(poolCtx context.Context, job *models.ReportJob) {
+	start := time.Now()
+	log := observability.Logger.With(
+		zap.String("job_id", job.ID.String()),
+		zap.String("type", job.Type),
+		zap.String("format", job.Format),
+		zap.Int("attempt", job.Attempts))
+	log.Info("Report job started")
+
+	ctx, cancel := context.WithTimeout(poolCtx, p.jobTimeout)
+	defer cancel()
+
+	key, size, rows, err := p.generate(ctx, job)
+	if err != nil && poolCtx.Err() != nil {
+		p.requeue(log, job)
+		return
+	}
+	finishedAt := time.Now()
+	updates := map[string]interface{}{"finished_at": finishedAt}
+	if err != nil {
+		log.Error("Report job failed", zap.Error(err))
+		updates["status"] = StatusFailed
+		updates["error"] = err.Error()
+	} else {
+		log.Info("Report job succeeded",
+			zap.Int64("rows", rows),
+			zap.Int64("bytes", size),
+			zap.Duration("duration", finishedAt.Sub(start)))
+		updates["status"] = StatusSucceeded
+		updates["result_key"] = key
+		updates["result_size"] = size
+		updates["row_count"] = rows
+	}
+	observability.ReportJobs.WithLabelValues(updates["status"].(string)).Inc()
+	observability.ReportJobDuration.Observe(finishedAt.Sub(start).Seconds())
+
+	// Record the outcome even if ctx ran out
+	if err := p.service.DB.WithContext(context.WithoutCancel(ctx)).
+		Model(job).
+		Where("status = ?", StatusRunning).
+		Updates(updates).Error; err != nil {
+		log.Error("Failed to record report job result", zap.Error(err))
+	}
+}
+
+// generate runs the job's export into the blob store.
+func (p *Pool) generate(ctx context.Context, job *models.ReportJob) (key string, size, rows int64, err error) {
+	params, err := jobParams(job.Params)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("decode params: %w", err)
+	}
+
+	key = fmt.Sprintf("reports/%s.%s", job.ID, job.Format)
+	size, rows, err = p.service.generate(ctx, job.Type, job.Format, params, key)
+	return key, size, rows, err
+}
+
+// requeue hands a job interrupted by shutdown back to the queue, without
+// counting the attempt, so another replica runs it instead of waiting for
+// it to go stale.
+func (p *Pool) requeue(log *zap.Logger, job *models.ReportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.service.DB.WithContext(ctx).
+		Model(job).
+		Where("status = ?", StatusRunning).
+		Updates(map[string]interface{}{
+			"status":     StatusQueued,
+			"attempts":   gorm.Expr("attempts - 1"),
+			"started_at": nil,
+		}).Error; err != nil {
+		log.Error("Failed to requeue interrupted report job", zap.Error(err))
+		return
+	}
+	log.Info("Report job interrupted by shutdown, requeued")
+}
@@ -0,0 +1,118 @@
+package reports
+
+import (
+	"context"
+	"lystage-proj/internals/leader"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const schedulerInterval = 30 * time.Second
+
+// Scheduler turns due schedules into deliveries, which report workers then
+// send. Only the replica elected by elector does any work, so each run is
+// enqueued once.
+type Scheduler struct {
+	service *Service
+	elector leader.Elector
+}
+
+func NewScheduler(service *Service, elector leader.Elector) *Scheduler {
+	return &Scheduler{service: service, elector: elector}
+}
+
+// Run checks for due schedules until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	observability.Logger.Info("Report scheduler started")
+
+	for {
+		if s.elector.IsLeader() {
+			s.tick(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	enqueued, err := s.enqueueDue(ctx)
+	if err != nil {
+		observability.Logger.Error("Failed to enqueue scheduled reports", zap.Error(err))
+	}
+	if enqueued > 0 {
+		s.service.notify()
+	}
+}
+
+// enqueueDue creates a delivery for every enabled schedule whose next run
+// has passed and advances it to its following run, returning how many it
+// created. Runs missed while no scheduler was up are collapsed into one.
+func (s *Scheduler) enqueueDue(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	var schedules []models.ReportSchedule
+	if err := s.service.DB.WithContext(ctx).
+		Where("enabled AND next_run_at <= ?", now).
+		Find(&schedules).Error; err != nil {
+		return 0, err
+	}
+
+	enqueued := 0
+	for _, schedule := range schedules {
+		next, err := nextRun(schedule.Cron, schedule.Timezone, now)
+		if err != nil {
+			// Stored schedules were validated, so this only happens if
+			// the timezone database changed; stop retrying every tick
+			observability.Logger.Error("Disabling report schedule with invalid timing",
+				zap.String("schedule_id", schedule.ID.String()), zap.Error(err))
+			if err := s.service.DB.WithContext(ctx).Model(&schedule).Update("enabled", false).Error; err != nil {
+				return enqueued, err
+			}
+			continue
+		}
+
+		// Advancing next_run_at only if it is unchanged keeps a run from
+		// being enqueued twice should two schedulers overlap; the delivery
+		// is created in the same transaction so the run cannot be lost
+		delivery := models.ReportDelivery{
+			ScheduleID:    schedule.ID,
+			ScheduledFor:  schedule.NextRunAt,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+		}
+		created := false
+		err = s.service.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.ReportSchedule{}).
+				Where("id = ? AND next_run_at = ?", schedule.ID, schedule.NextRunAt).
+				Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			created = true
+			return tx.Create(&delivery).Error
+		})
+		if err != nil {
+			return enqueued, err
+		}
+		if !created {
+			continue
+		}
+		enqueued++
+		observability.Logger.Info("Scheduled report due",
+			zap.String("schedule_id", schedule.ID.String()),
+			zap.String("delivery_id", delivery.ID.String()),
+			zap.Time("next_run_at", next))
+	}
+	return enqueued, nil
+}
@@ -0,0 +1,202 @@
+package reports
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending" // Claimed by a report worker
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+var errScheduleNotFound = errors.New("report schedule not found")
+
+// ScheduleRequest creates or replaces a report schedule. Secret is the HMAC
+// key for webhook signatures; one is generated if it is omitted.
+type ScheduleRequest struct {
+	Name       string            `json:"name" binding:"required"`
+	Cron       string            `json:"cron" binding:"required"`
+	Timezone   string            `json:"timezone"`
+	Type       string            `json:"type" binding:"required"`
+	Format     string            `json:"format"`
+	Params     map[string]string `json:"params"`
+	WebhookURL string            `json:"webhook_url" binding:"required"`
+	Secret     string            `json:"secret"`
+	Enabled    *bool             `json:"enabled"`
+}
+
+// ScheduleResponse is the API view of a schedule. Secret is only returned
+// when the schedule is created.
+type ScheduleResponse struct {
+	models.ReportSchedule
+	Params map[string]string `json:"params"`
+	Secret string            `json:"secret,omitempty"`
+}
+
+// nextRun returns the first time after now that the schedule fires.
+func nextRun(expr, timezone string, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", expr)
+	}
+	return next.UTC(), nil
+}
+
+// scheduleFromRequest validates req and applies it to schedule.
+func (s *Service) scheduleFromRequest(ctx context.Context, req ScheduleRequest, schedule *models.ReportSchedule) error {
+	if req.Format == "" {
+		req.Format = analytics.FormatCSV
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if err := s.validate(ReportDefinition{Type: req.Type, Format: req.Format, Params: req.Params}); err != nil {
+		return err
+	}
+
+	if err := validateWebhookURL(ctx, req.WebhookURL); err != nil {
+		return err
+	}
+
+	nextRunAt, err := nextRun(req.Cron, req.Timezone, time.Now())
+	if err != nil {
+		return err
+	}
+
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return err
+	}
+
+	schedule.Name = req.Name
+	schedule.Cron = req.Cron
+	schedule.Timezone = req.Timezone
+	schedule.Type = req.Type
+	schedule.Format = req.Format
+	schedule.Params = string(params)
+	schedule.WebhookURL = req.WebhookURL
+	schedule.NextRunAt = nextRunAt
+	if req.Secret != "" {
+		schedule.Secret = req.Secret
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// CreateSchedule validates and stores a new schedule.
+func (s *Service) CreateSchedule(ctx context.Context, req ScheduleRequest) (*models.ReportSchedule, error) {
+	schedule := &models.ReportSchedule{ID: uuid.New(), Enabled: true}
+	if err := s.scheduleFromRequest(ctx, req, schedule); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidDefinition, err)
+	}
+	if schedule.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		schedule.Secret = hex.EncodeToString(secret)
+	}
+
+	if err := s.DB.WithContext(ctx).Create(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// UpdateSchedule replaces a schedule's definition. The secret is kept
+// unless a new one is given, and the next run is recomputed.
+func (s *Service) UpdateSchedule(ctx context.Context, id uuid.UUID, req ScheduleRequest) (*models.ReportSchedule, error) {
+	schedule, err := s.GetSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.scheduleFromRequest(ctx, req, schedule); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidDefinition, err)
+	}
+
+	if err := s.DB.WithContext(ctx).Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *Service) GetSchedule(ctx context.Context, id uuid.UUID) (*models.ReportSchedule, error) {
+	var schedule models.ReportSchedule
+	err := s.DB.WithContext(ctx).First(&schedule, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (s *Service) ListSchedules(ctx context.Context) ([]models.ReportSchedule, error) {
+	var schedules []models.ReportSchedule
+	err := s.DB.WithContext(ctx).Order("created_at DESC").Find(&schedules).Error
+	return schedules, err
+}
+
+// DeleteSchedule removes a schedule and its delivery history.
+func (s *Service) DeleteSchedule(ctx context.Context, id uuid.UUID) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.ReportSchedule{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errScheduleNotFound
+		}
+		return tx.Delete(&models.ReportDelivery{}, "schedule_id = ?", id).Error
+	})
+}
+
+// ListDeliveries returns a schedule's most recent deliveries, newest first.
+func (s *Service) ListDeliveries(ctx context.Context, scheduleID uuid.UUID, limit int) ([]models.ReportDelivery, error) {
+	if _, err := s.GetSchedule(ctx, scheduleID); err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.ReportDelivery
+	err := s.DB.WithContext(ctx).
+		Where("schedule_id = ?", scheduleID).
+		Order("scheduled_for DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+func newScheduleResponse(schedule *models.ReportSchedule, includeSecret bool) ScheduleResponse {
+	params, _ := jobParams(schedule.Params)
+	resp := ScheduleResponse{ReportSchedule: *schedule, Params: params}
+	if includeSecret {
+		resp.Secret = schedule.Secret
+	}
+	return resp
+}
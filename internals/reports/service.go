@@ -0,0 +1,210 @@
+package reports
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/blob"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/models"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// submitLockID keys the Postgres advisory lock that serializes submissions
+// while the queue is limited.
+const submitLockID = 38001
+
+type Service struct {
+	DB        *gorm.DB
+	analytics *analytics.Service
+	store     blob.Store
+	maxQueued int64
+	wake      chan struct{} // Signals local workers that a job or delivery was queued
+}
+
+// NewService creates the report service. At most maxQueued jobs may wait
+// to run at any time across all replicas.
+func NewService(analyticsService *analytics.Service, store blob.Store, maxQueued int) *Service {
+	return &Service{
+		DB:        db.GormDB,
+		analytics: analyticsService,
+		store:     store,
+		maxQueued: int64(maxQueued),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Submit validates a report definition and queues a job for it.
+func (s *Service) Submit(ctx context.Context, def ReportDefinition) (*models.ReportJob, error) {
+	if def.Format == "" {
+		def.Format = analytics.FormatCSV
+	}
+	if err := s.validate(def); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidDefinition, err)
+	}
+
+	params, err := json.Marshal(def.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ReportJob{
+		ID:     uuid.New(),
+		Type:   def.Type,
+		Format: def.Format,
+		Params: string(params),
+		Status: StatusQueued,
+	}
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if s.maxQueued > 0 {
+			// Submissions take turns, so the count holds until the insert
+			// commits; the lock is released with the transaction
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", submitLockID).Error; err != nil {
+				return err
+			}
+
+			var queued int64
+			if err := tx.Model(&models.ReportJob{}).
+				Where("status = ?", StatusQueued).
+				Count(&queued).Error; err != nil {
+				return err
+			}
+			if queued >= s.maxQueued {
+				return errQueueFull
+			}
+		}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify()
+	return job, nil
+}
+
+// notify wakes a local worker to pick up newly queued work.
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // A wake-up is already pending
+	}
+}
+
+func (s *Service) validate(def ReportDefinition) error {
+	if def.Type != TypeAnalytics && def.Type != TypeClicks {
+		return fmt.Errorf("unsupported report type %q", def.Type)
+	}
+	if !analytics.ValidExportFormat(def.Format) {
+		return fmt.Errorf("unsupported format %q", def.Format)
+	}
+
+	filters, err := analytics.ParseFilters(paramValues(def.Params))
+	if err != nil {
+		return err
+	}
+	if def.Type == TypeAnalytics && filters.Compare != "" {
+		return fmt.Errorf("compare is not supported by analytics reports")
+	}
+	return s.analytics.ValidateFilters(filters)
+}
+
+// Get returns a job by ID.
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*models.ReportJob, error) {
+	var job models.ReportJob
+	err := s.DB.WithContext(ctx).First(&job, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// DeleteExpired deletes up to limit jobs that finished before cutoff, along
+// with their results, and returns how many it deleted.
+func (s *Service) DeleteExpired(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	var jobs []models.ReportJob
+	if err := s.DB.WithContext(ctx).
+		Select("id", "result_key").
+		Where("status IN ? AND finished_at < ?", []string{StatusSucceeded, StatusFailed}, cutoff).
+		Order("finished_at").
+		Limit(limit).
+		Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, job := range jobs {
+		// The result goes first, so a failure leaves the job to retry
+		if job.ResultKey != "" {
+			if err := s.store.Delete(ctx, job.ResultKey); err != nil {
+				return deleted, fmt.Errorf("delete result of job %s: %w", job.ID, err)
+			}
+		}
+		if err := s.DB.WithContext(ctx).Delete(&models.ReportJob{}, "id = ?", job.ID).Error; err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// OpenResult opens the result of a finished job.
+func (s *Service) OpenResult(ctx context.Context, job *models.ReportJob) (io.ReadCloser, int64, error) {
+	if job.Status != StatusSucceeded {
+		return nil, 0, errNotReady
+	}
+	return s.store.Open(ctx, job.ResultKey)
+}
+
+// generate exports a report of the given type into the blob store under
+// key. Params are resolved now, so relative ranges end at the current time.
+func (s *Service) generate(ctx context.Context, reportType, format string, params map[string]string, key string) (size, rows int64, err error) {
+	filters, err := analytics.ParseFilters(paramValues(params))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	export := s.analytics.ExportAnalytics
+	if reportType == TypeClicks {
+		export = s.analytics.ExportClicks
+	}
+
+	size, err = s.store.Write(ctx, key, func(w io.Writer) error {
+		buf := bufio.NewWriterSize(w, 64*1024)
+		n, err := export(ctx, filters, format, buf, func() {})
+		rows = n
+		if err != nil {
+			return err
+		}
+		return buf.Flush()
+	})
+	return size, rows, err
+}
+
+// jobParams decodes stored report params.
+func jobParams(raw string) (map[string]string, error) {
+	params := make(map[string]string)
+	if err := json.Unmarshal([]byte(raw), &params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func paramValues(params map[string]string) url.Values {
+	values := make(url.Values, len(params))
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	return values
+}
@@ -0,0 +1,77 @@
+package reports
+
+import (
+	"errors"
+	"lystage-proj/internals/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report types.
+const (
+	TypeAnalytics = "analytics" // Aggregated rows, as GET /ads/analytics/export
+	TypeClicks    = "clicks"    // Raw clicks, as GET /ads/clicks/export
+)
+
+// Job statuses.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var (
+	errInvalidDefinition = errors.New("invalid report definition")
+	errQueueFull         = errors.New("too many queued reports")
+	errJobNotFound       = errors.New("report job not found")
+	errNotReady          = errors.New("report is not ready")
+)
+
+// ReportDefinition describes a report to generate. Params takes the same
+// query parameters as GET /ads/analytics, e.g. {"since": "...",
+// "group_by": "country"}; pagination parameters are ignored.
+type ReportDefinition struct {
+	Type   string            `json:"type" binding:"required"`
+	Format string            `json:"format"`
+	Params map[string]string `json:"params"`
+}
+
+// JobResponse is the API view of a report job.
+type JobResponse struct {
+	ID          uuid.UUID         `json:"id"`
+	Type        string            `json:"type"`
+	Format      string            `json:"format"`
+	Params      map[string]string `json:"params"`
+	Status      string            `json:"status"`
+	Attempts    int               `json:"attempts"`
+	Error       string            `json:"error,omitempty"`
+	RowCount    int64             `json:"row_count,omitempty"`
+	ResultSize  int64             `json:"result_size,omitempty"`
+	DownloadURL string            `json:"download_url,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+}
+
+func newJobResponse(job *models.ReportJob, params map[string]string, downloadURL string) JobResponse {
+	resp := JobResponse{
+		ID:         job.ID,
+		Type:       job.Type,
+		Format:     job.Format,
+		Params:     params,
+		Status:     job.Status,
+		Attempts:   job.Attempts,
+		Error:      job.Error,
+		RowCount:   job.RowCount,
+		ResultSize: job.ResultSize,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Status == StatusSucceeded {
+		resp.DownloadURL = downloadURL
+	}
+	return resp
+}
@@ -0,0 +1,252 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/blob"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// SubmitReport handles POST /reports.
+func (h *Handler) SubmitReport(c *gin.Context) {
+	var def ReportDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	job, err := h.service.Submit(c.Request.Context(), def)
+	switch {
+	case errors.Is(err, errInvalidDefinition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errQueueFull):
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		observability.Logger.Error("Failed to submit report", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit report"})
+		return
+	}
+
+	c.Header("Location", jobURL(c, job))
+	c.JSON(http.StatusAccepted, newJobResponse(job, def.Params, downloadURL(c, job)))
+}
+
+// GetReport handles GET /reports/:id.
+func (h *Handler) GetReport(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+
+	params, err := jobParams(job.Params)
+	if err != nil {
+		observability.Logger.Error("Invalid stored report params", zap.Error(err), zap.String("job_id", job.ID.String()))
+	}
+	c.JSON(http.StatusOK, newJobResponse(job, params, downloadURL(c, job)))
+}
+
+// DownloadReport handles GET /reports/:id/download.
+func (h *Handler) DownloadReport(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+
+	result, size, err := h.service.OpenResult(c.Request.Context(), job)
+	switch {
+	case errors.Is(err, errNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": job.Status})
+		return
+	case errors.Is(err, blob.ErrNotFound):
+		c.JSON(http.StatusGone, gin.H{"error": "Report result is no longer available"})
+		return
+	case err != nil:
+		observability.Logger.Error("Failed to open report result", zap.Error(err), zap.String("job_id", job.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open report result"})
+		return
+	}
+	defer result.Close()
+
+	filename := fmt.Sprintf("report_%s_%s.%s", job.Type, job.ID, job.Format)
+	c.Header("Content-Type", analytics.ExportContentType(job.Format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, result); err != nil {
+		observability.Logger.Warn("Report download interrupted", zap.Error(err), zap.String("job_id", job.ID.String()))
+	}
+}
+
+func (h *Handler) loadJob(c *gin.Context) (*models.ReportJob, bool) {
+	id, ok := parseID(c)
+	if !ok {
+		return nil, false
+	}
+
+	job, err := h.service.Get(c.Request.Context(), id)
+	if errors.Is(err, errJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		observability.Logger.Error("Failed to load report job", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load report"})
+		return nil, false
+	}
+	return job, true
+}
+
+// jobURL is the status URL of a job under the route group the request
+// came in on.
+func jobURL(c *gin.Context, job *models.ReportJob) string {
+	return strings.TrimSuffix(c.FullPath(), "/:id") + "/" + job.ID.String()
+}
+
+func downloadURL(c *gin.Context, job *models.ReportJob) string {
+	return jobURL(c, job) + "/download"
+}
+
+// CreateSchedule handles POST /report-schedules. The response includes the
+// webhook signing secret, which is not returned again.
+func (h *Handler) CreateSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	schedule, err := h.service.CreateSchedule(c.Request.Context(), req)
+	if !h.scheduleError(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, newScheduleResponse(schedule, true))
+}
+
+// ListSchedules handles GET /report-schedules.
+func (h *Handler) ListSchedules(c *gin.Context) {
+	schedules, err := h.service.ListSchedules(c.Request.Context())
+	if !h.scheduleError(c, err) {
+		return
+	}
+
+	resp := make([]ScheduleResponse, len(schedules))
+	for i := range schedules {
+		resp[i] = newScheduleResponse(&schedules[i], false)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": resp})
+}
+
+// GetSchedule handles GET /report-schedules/:id.
+func (h *Handler) GetSchedule(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.GetSchedule(c.Request.Context(), id)
+	if !h.scheduleError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, newScheduleResponse(schedule, false))
+}
+
+// UpdateSchedule handles PUT /report-schedules/:id.
+func (h *Handler) UpdateSchedule(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	schedule, err := h.service.UpdateSchedule(c.Request.Context(), id, req)
+	if !h.scheduleError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, newScheduleResponse(schedule, false))
+}
+
+// DeleteSchedule handles DELETE /report-schedules/:id.
+func (h *Handler) DeleteSchedule(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if !h.scheduleError(c, h.service.DeleteSchedule(c.Request.Context(), id)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries handles GET /report-schedules/:id/deliveries, the delivery
+// history of a schedule.
+func (h *Handler) ListDeliveries(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(c.Request.Context(), id, limit)
+	if !h.scheduleError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
+// scheduleError writes the response for a schedule service error and
+// reports whether the handler may continue.
+func (h *Handler) scheduleError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errInvalidDefinition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		observability.Logger.Error("Report schedule request failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process report schedule"})
+	}
+	return false
+}
+
+func parseID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
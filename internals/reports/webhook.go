@@ -0,0 +1,119 @@
+package reports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var errBlockedAddress = errors.New("webhook address is not publicly routable")
+
+// blockedPrefixes are ranges webhooks may not reach besides those caught by
+// the netip predicates in blockedAddr: shared address space, which some
+// clouds use for metadata services, and NAT64 forms of internal addresses.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// blockedAddr reports whether addr is internal to the deployment: loopback,
+// private (RFC 1918 and IPv6 ULA), link-local (including 169.254.169.254,
+// the cloud metadata address), unspecified or multicast.
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhookURL checks that raw is an absolute http(s) URL whose host
+// only resolves to public addresses. The check is repeated when connecting,
+// since DNS may answer differently by then.
+func validateWebhookURL(ctx context.Context, raw string) error {
+	webhook, err := url.Parse(raw)
+	if err != nil || (webhook.Scheme != "https" && webhook.Scheme != "http") || webhook.Host == "" {
+		return fmt.Errorf("webhook_url must be an absolute http(s) URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", webhook.Hostname())
+	if err != nil {
+		return fmt.Errorf("webhook_url host does not resolve: %w", err)
+	}
+	for _, addr := range addrs {
+		if blockedAddr(addr) {
+			return fmt.Errorf("webhook_url resolves to %s: %w", addr, errBlockedAddress)
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns a client that refuses to connect to blocked
+// addresses. The address is checked after resolution, right before the
+// connection is made, which also covers redirects and DNS rebinding.
+// Proxies are not used, as they would hide the destination.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if blockedAddr(addrPort.Addr()) {
+				return fmt.Errorf("dial %s: %w", address, errBlockedAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// signWebhook signs body as t=<unix seconds>,v1=<hex HMAC-SHA256 of
+// "<t>.<body>"> with secret, so receivers can verify it and reject replays.
+func signWebhook(secret string, at time.Time, body io.Reader) (string, error) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	if _, err := io.Copy(mac, body); err != nil {
+		return "", err
+	}
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// nextDeliveryAttempt returns when to retry a delivery that has failed
+// attempts times, doubling the delay from deliveryRetryBase, or false once
+// the attempts are used up.
+func nextDeliveryAttempt(attempts int, failedAt time.Time) (time.Time, bool) {
+	if attempts >= maxDeliveryAttempts {
+		return time.Time{}, false
+	}
+	return failedAt.Add(deliveryRetryBase << (attempts - 1)), true
+}
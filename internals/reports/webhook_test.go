@@ -0,0 +1,182 @@
+package reports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"lystage-proj/internals/blob"
+	"lystage-proj/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSignWebhook(t *testing.T) {
+	at := time.Unix(1767225600, 0)
+	signature, err := signWebhook("s3cret", at, strings.NewReader("ad_id,clicks\n1,2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1767225600.ad_id,clicks\n1,2\n"))
+	want := "t=1767225600,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if signature != want {
+		t.Fatalf("signature = %q, want %q", signature, want)
+	}
+
+	other, _ := signWebhook("other", at, strings.NewReader("ad_id,clicks\n1,2\n"))
+	if other == signature {
+		t.Fatal("signature does not depend on the secret")
+	}
+	later, _ := signWebhook("s3cret", at.Add(time.Second), strings.NewReader("ad_id,clicks\n1,2\n"))
+	if later == signature {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+}
+
+func TestNextDeliveryAttempt(t *testing.T) {
+	failedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for attempts, delay := range map[int]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: 8 * time.Minute,
+		5: 16 * time.Minute,
+	} {
+		retryAt, ok := nextDeliveryAttempt(attempts, failedAt)
+		if !ok || !retryAt.Equal(failedAt.Add(delay)) {
+			t.Errorf("after %d attempts: retry at %s, %t; want %s", attempts, retryAt, ok, failedAt.Add(delay))
+		}
+	}
+
+	if _, ok := nextDeliveryAttempt(maxDeliveryAttempts, failedAt); ok {
+		t.Errorf("retried after %d attempts", maxDeliveryAttempts)
+	}
+}
+
+func TestPostSignsReport(t *testing.T) {
+	const report = "ad_id,clicks\n1,2\n"
+
+	store, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Write(context.Background(), "deliveries/d.csv", func(w io.Writer) error {
+		_, err := io.WriteString(w, report)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule := &models.ReportSchedule{ID: uuid.New(), Type: TypeAnalytics, Format: "csv", Secret: "s3cret"}
+	delivery := &models.ReportDelivery{ID: uuid.New(), ScheduleID: schedule.ID, ResultKey: "deliveries/d.csv"}
+
+	status := http.StatusNoContent
+	var received struct {
+		body, signature, scheduleID, deliveryID string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.body = string(body)
+		received.signature = r.Header.Get(signatureHeader)
+		received.scheduleID = r.Header.Get(scheduleIDHeader)
+		received.deliveryID = r.Header.Get(deliveryIDHeader)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	schedule.WebhookURL = server.URL
+
+	// The test server is on loopback, which the webhook client refuses
+	d := &deliverer{service: &Service{store: store}, client: server.Client()}
+
+	got, err := d.post(context.Background(), schedule, delivery)
+	if err != nil || got != http.StatusNoContent {
+		t.Fatalf("post = %d, %v", got, err)
+	}
+	if received.body != report {
+		t.Fatalf("body = %q, want %q", received.body, report)
+	}
+	if received.scheduleID != schedule.ID.String() || received.deliveryID != delivery.ID.String() {
+		t.Fatalf("ids = %s, %s", received.scheduleID, received.deliveryID)
+	}
+
+	// Receivers verify by recomputing over the timestamp and body
+	timestamp, mac, ok := strings.Cut(strings.TrimPrefix(received.signature, "t="), ",v1=")
+	if !ok {
+		t.Fatalf("malformed signature %q", received.signature)
+	}
+	want := hmac.New(sha256.New, []byte("s3cret"))
+	want.Write([]byte(timestamp + "." + report))
+	if mac != hex.EncodeToString(want.Sum(nil)) {
+		t.Fatalf("signature %q does not verify", received.signature)
+	}
+
+	status = http.StatusBadGateway
+	if got, err := d.post(context.Background(), schedule, delivery); err == nil || got != http.StatusBadGateway {
+		t.Fatalf("post to failing webhook = %d, %v", got, err)
+	}
+}
+
+func TestBlockedAddr(t *testing.T) {
+	for addr, blocked := range map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"100.100.100.200":  true,
+		"0.0.0.0":          true,
+		"224.0.0.1":        true,
+		"::1":              true,
+		"fe80::1":          true,
+		"fd00:ec2::254":    true,
+		"::ffff:127.0.0.1": true,
+		"64:ff9b::a00:1":   true,
+		"93.184.216.34":    false,
+		"2606:4700::1111":  false,
+	} {
+		if got := blockedAddr(netip.MustParseAddr(addr)); got != blocked {
+			t.Errorf("blockedAddr(%s) = %t, want %t", addr, got, blocked)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://93.184.216.34/hooks":         true,
+		"http://127.0.0.1:8080/":              false,
+		"http://localhost/":                   false,
+		"http://169.254.169.254/latest/meta":  false,
+		"https://10.0.0.5/":                   false,
+		"http://[::1]/":                       false,
+		"ftp://93.184.216.34/":                false,
+		"/relative":                           false,
+		"https://user@192.168.0.1:443/hooks/": false,
+	} {
+		err := validateWebhookURL(context.Background(), raw)
+		if (err == nil) != ok {
+			t.Errorf("validateWebhookURL(%q) = %v, want ok %t", raw, err, ok)
+		}
+	}
+}
+
+func TestWebhookClientRefusesBlockedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer server.Close()
+
+	_, err := newWebhookClient().Get(server.URL)
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("err = %v, want %v", err, errBlockedAddress)
+	}
+}
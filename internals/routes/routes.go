@@ -2,17 +2,29 @@
 package api
 
 import (
+	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/budget"
 	"lystage-proj/internals/config"
+	"lystage-proj/internals/flight"
+	"lystage-proj/internals/lifecycle"
 	"lystage-proj/internals/observability"
+	"lystage-proj/internals/reports"
 	v1 "lystage-proj/internals/routes/v1"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
-func SetupRouter(cfg *config.Config) *gin.Engine {
+func SetupRouter(cfg *config.Config, background *lifecycle.Group, analyticsService *analytics.Service, reportService *reports.Service, ledger *budget.Ledger, flights *flight.Checker) *gin.Engine {
 	router := gin.New()
 
+	// Client IPs key rate limits and fraud rules, so X-Forwarded-For is
+	// only believed from configured proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		observability.Logger.Fatal("Invalid TRUSTED_PROXIES", zap.Error(err))
+	}
+
 	// Middleware
 	router.Use(gin.Recovery())
 	router.Use(config.Logger()) // structured logs
@@ -22,13 +34,25 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 	apiGroup := router.Group("/api/v1")
 
 	// Ads routes
-	v1.RegisterAdRoutes(apiGroup)
+	v1.RegisterAdRoutes(apiGroup, cfg, background, ledger)
+
+	// Creative variants of ads under A/B test
+	v1.RegisterVariantRoutes(apiGroup)
+
+	// Advertisers and campaigns
+	v1.RegisterCampaignRoutes(apiGroup)
 
-	// Clicks routes
-	v1.RegisterClickRoutes(apiGroup)
+	// Clicks routes, plus click tracking links outside /api/v1
+	v1.RegisterClickRoutes(apiGroup, &router.RouterGroup, cfg, flights)
 
 	// Analytics routes
-	v1.RegisterAnalyticsRoutes(apiGroup)
+	v1.RegisterAnalyticsRoutes(apiGroup, cfg, analyticsService)
+
+	// Asynchronous report jobs
+	v1.RegisterReportRoutes(apiGroup, reportService)
+
+	// Live analytics push (SSE and WebSocket)
+	v1.RegisterLiveRoutes(apiGroup, cfg)
 	// Prometheus metrics endpoint (outside /api/v1)
 
 	return router
@@ -2,16 +2,24 @@ package routes
 
 import (
 	"lystage-proj/internals/ads"
+	"lystage-proj/internals/budget"
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/lifecycle"
+	"lystage-proj/internals/serving"
+	"lystage-proj/internals/tracking"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterAdRoutes(rg *gin.RouterGroup) {
+func RegisterAdRoutes(rg *gin.RouterGroup, cfg *config.Config, background *lifecycle.Group, ledger *budget.Ledger) {
 	adService := ads.NewAdService()
+	signer := tracking.NewSignerFromConfig(cfg)
 	adHandler := ads.NewHandler(adService)
+	servingHandler := serving.NewHandler(serving.NewService(background, signer, cfg.AdServingRefreshInterval, serving.NewFrequencyStoreFromConfig(cfg), ledger))
 
-	adGroup := rg.Group("/ads")
+	adGroup := rg.Group("/ads", config.Timeout(cfg.AdsQueryTimeout))
 	{
 		adGroup.GET("", adHandler.GetAdsHandler)
+		adGroup.GET("/serve", servingHandler.ServeAd)
 	}
 }
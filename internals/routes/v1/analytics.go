@@ -2,16 +2,19 @@ package routes
 
 import (
 	"lystage-proj/internals/analytics"
+	"lystage-proj/internals/config"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterAnalyticsRoutes(rg *gin.RouterGroup) {
-	service := analytics.NewService()
+func RegisterAnalyticsRoutes(rg *gin.RouterGroup, cfg *config.Config, service *analytics.Service) {
 	handler := analytics.NewHandler(service)
 
 	analyticsGroup := rg.Group("/ads")
 	{
-		analyticsGroup.GET("/analytics", handler.GetAdAnalytics)
+		analyticsGroup.GET("/analytics", config.Timeout(cfg.AnalyticsQueryTimeout), handler.GetAdAnalytics)
+		analyticsGroup.GET("/analytics/export", config.Timeout(cfg.ExportTimeout), handler.ExportAnalytics)
+		analyticsGroup.GET("/analytics/variants", config.Timeout(cfg.AnalyticsQueryTimeout), handler.GetVariantReport)
+		analyticsGroup.GET("/clicks/export", config.Timeout(cfg.ExportTimeout), handler.ExportClicks)
 	}
 }
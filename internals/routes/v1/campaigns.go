@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"lystage-proj/internals/campaigns"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterCampaignRoutes(rg *gin.RouterGroup) {
+	handler := campaigns.NewHandler(campaigns.NewService())
+
+	advertiserGroup := rg.Group("/advertisers")
+	{
+		advertiserGroup.POST("", handler.CreateAdvertiser)
+		advertiserGroup.GET("", handler.ListAdvertisers)
+		advertiserGroup.GET("/:id", handler.GetAdvertiser)
+		advertiserGroup.PUT("/:id", handler.UpdateAdvertiser)
+		advertiserGroup.DELETE("/:id", handler.DeleteAdvertiser)
+	}
+
+	campaignGroup := rg.Group("/campaigns")
+	{
+		campaignGroup.POST("", handler.CreateCampaign)
+		campaignGroup.GET("", handler.ListCampaigns)
+		campaignGroup.GET("/:id", handler.GetCampaign)
+		campaignGroup.PUT("/:id", handler.UpdateCampaign)
+		campaignGroup.DELETE("/:id", handler.DeleteCampaign)
+		campaignGroup.GET("/:id/ads", handler.ListCampaignAds)
+		campaignGroup.POST("/:id/ads", handler.AssignAds)
+		campaignGroup.DELETE("/:id/ads/:ad_id", handler.UnassignAd)
+	}
+}
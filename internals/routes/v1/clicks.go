@@ -1,17 +1,40 @@
 package routes
 
 import (
+	"lystage-proj/internals/ads"
 	"lystage-proj/internals/clicks"
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/flight"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/ratelimit"
+	"lystage-proj/internals/tracking"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterClickRoutes(r *gin.RouterGroup) {
-	service := clicks.NewService()
+// RegisterClickRoutes registers click ingestion under r and, when click
+// tokens are enabled, the /c/:token tracking links under root. Clicks
+// outside their flights are rejected if FLIGHT_CLICK_POLICY is reject.
+func RegisterClickRoutes(r *gin.RouterGroup, root *gin.RouterGroup, cfg *config.Config, flights *flight.Checker) {
+	signer := tracking.NewSignerFromConfig(cfg)
+	if cfg.FlightClickPolicy != "reject" {
+		flights = nil
+	}
+	service := clicks.NewService(cfg.VisitorSalt, signer, tracking.NewReplayGuardFromConfig(cfg), flights)
 	handler := clicks.NewHandler(service)
+	limits := ratelimit.NewStoreFromConfig(cfg)
 
 	clickGroup := r.Group("/ads")
 	{
-		clickGroup.POST("/click", handler.HandleClick)
+		limiter := ratelimit.Middleware(limits, ratelimit.ClickRules(cfg, ratelimit.ByClientIPAndAd)...)
+		clickGroup.POST("/click", limiter, config.Timeout(cfg.ClickTimeout), handler.HandleClick)
+	}
+
+	if signer == nil {
+		observability.Logger.Warn("Click tracking links (/c/:token) are disabled without CLICK_TOKEN_SECRET")
+		return
 	}
+	redirectHandler := clicks.NewRedirectHandler(service, signer, ads.NewAdService(), cfg.RedirectAllowedHosts)
+	limiter := ratelimit.Middleware(limits, ratelimit.ClickRules(cfg, ratelimit.ByClientIPAndTokenAd(signer))...)
+	root.GET("/c/:token", limiter, config.Timeout(cfg.ClickTimeout), redirectHandler.HandleRedirect)
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/live"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterLiveRoutes(rg *gin.RouterGroup, cfg *config.Config) {
+	handler := live.NewHandler(live.DefaultHub, cfg.LiveEmitInterval, cfg.LiveAllowedOrigins)
+
+	liveGroup := rg.Group("/ads/analytics")
+	{
+		liveGroup.GET("/stream", handler.StreamAnalytics)
+		liveGroup.GET("/ws", handler.AnalyticsWebSocket)
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"lystage-proj/internals/reports"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterReportRoutes(rg *gin.RouterGroup, service *reports.Service) {
+	handler := reports.NewHandler(service)
+
+	reportGroup := rg.Group("/reports")
+	{
+		reportGroup.POST("", handler.SubmitReport)
+		reportGroup.GET("/:id", handler.GetReport)
+		reportGroup.GET("/:id/download", handler.DownloadReport)
+	}
+
+	scheduleGroup := rg.Group("/report-schedules")
+	{
+		scheduleGroup.POST("", handler.CreateSchedule)
+		scheduleGroup.GET("", handler.ListSchedules)
+		scheduleGroup.GET("/:id", handler.GetSchedule)
+		scheduleGroup.PUT("/:id", handler.UpdateSchedule)
+		scheduleGroup.DELETE("/:id", handler.DeleteSchedule)
+		scheduleGroup.GET("/:id/deliveries", handler.ListDeliveries)
+	}
+}
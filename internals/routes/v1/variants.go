@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"lystage-proj/internals/variants"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterVariantRoutes(rg *gin.RouterGroup) {
+	handler := variants.NewHandler(variants.NewService())
+
+	variantGroup := rg.Group("/ads/:id/variants")
+	{
+		variantGroup.POST("", handler.CreateVariant)
+		variantGroup.GET("", handler.ListVariants)
+		variantGroup.GET("/:variant_id", handler.GetVariant)
+		variantGroup.PUT("/:variant_id", handler.UpdateVariant)
+		variantGroup.DELETE("/:variant_id", handler.DeleteVariant)
+	}
+}
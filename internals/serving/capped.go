@@ -0,0 +1,103 @@
+package serving
+
+import (
+	"context"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	servingRollupBucket        = time.Hour
+	servingRollupFlushInterval = 30 * time.Second
+)
+
+type servingRollupKey struct {
+	adID        uint
+	bucketStart time.Time
+}
+
+// cappedCounter buffers capped requests per ad-hour and periodically adds
+// them to serving_rollups, like the worker does for click rollups.
+type cappedCounter struct {
+	db     *gorm.DB
+	mu     sync.Mutex
+	counts map[servingRollupKey]int64
+}
+
+func newCappedCounter(db *gorm.DB) *cappedCounter {
+	return &cappedCounter{db: db, counts: make(map[servingRollupKey]int64)}
+}
+
+// Add records that adID was withheld from a request at t by its cap.
+func (c *cappedCounter) Add(adID uint, t time.Time) {
+	key := servingRollupKey{adID: adID, bucketStart: t.UTC().Truncate(servingRollupBucket)}
+
+	c.mu.Lock()
+	c.counts[key]++
+	c.mu.Unlock()
+}
+
+// Run flushes buffered counts on a fixed interval until ctx is done.
+func (c *cappedCounter) Run(ctx context.Context) {
+	ticker := time.NewTicker(servingRollupFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.flush()
+			return
+		case <-ticker.C:
+			c.flush()
+		}
+	}
+}
+
+func (c *cappedCounter) flush() {
+	c.mu.Lock()
+	counts := c.counts
+	c.counts = make(map[servingRollupKey]int64)
+	c.mu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	rows := make([]models.ServingRollup, 0, len(counts))
+	for key, count := range counts {
+		rows = append(rows, models.ServingRollup{AdID: key.adID, BucketStart: key.bucketStart, CappedRequests: count})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "ad_id"}, {Name: "bucket_start"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"capped_requests": gorm.Expr("serving_rollups.capped_requests + EXCLUDED.capped_requests"),
+			"updated_at":      gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		// Keep the counts for the next flush rather than losing them
+		observability.Logger.Error("Failed to flush serving rollups",
+			zap.Error(err),
+			zap.Int("buckets", len(rows)))
+		c.restore(counts)
+	}
+}
+
+// restore merges counts that failed to flush back into the buffer.
+func (c *cappedCounter) restore(counts map[servingRollupKey]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, count := range counts {
+		c.counts[key] += count
+	}
+}
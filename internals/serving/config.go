@@ -0,0 +1,15 @@
+package serving
+
+import (
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/db"
+)
+
+// NewFrequencyStoreFromConfig returns the impression counter store
+// selected in cfg.
+func NewFrequencyStoreFromConfig(cfg *config.Config) FrequencyStore {
+	if cfg.FrequencyCapBackend == "redis" {
+		return NewRedisFrequencyStore(db.Redis)
+	}
+	return NewMemoryFrequencyStore()
+}
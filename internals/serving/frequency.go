@@ -0,0 +1,127 @@
+package serving
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const frequencyKeyPrefix = "lvstage:freq:"
+
+// FrequencyStore counts impressions per key in fixed windows that start
+// at the key's first impression.
+type FrequencyStore interface {
+	// Counts returns the impressions in the current window of each key.
+	Counts(ctx context.Context, keys []string) ([]int64, error)
+	// Take records an impression if the key has fewer than limit in its
+	// window, starting a window of the given length if none is open, and
+	// reports whether it did. The check and the increment are atomic, so
+	// concurrent requests cannot take the key past its limit.
+	Take(ctx context.Context, key string, limit int64, window time.Duration) (bool, error)
+}
+
+// MemoryFrequencyStore keeps counters on this replica only.
+type MemoryFrequencyStore struct {
+	mu       sync.Mutex
+	counters map[string]*frequencyCounter
+	incrs    int
+}
+
+type frequencyCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func NewMemoryFrequencyStore() *MemoryFrequencyStore {
+	return &MemoryFrequencyStore{counters: make(map[string]*frequencyCounter)}
+}
+
+func (s *MemoryFrequencyStore) Counts(_ context.Context, keys []string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counts := make([]int64, len(keys))
+	for i, key := range keys {
+		if counter, ok := s.counters[key]; ok && now.Before(counter.expiresAt) {
+			counts[i] = counter.count
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryFrequencyStore) Take(_ context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.incrs++; s.incrs%10000 == 0 {
+		for k, counter := range s.counters {
+			if !now.Before(counter.expiresAt) {
+				delete(s.counters, k)
+			}
+		}
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		counter = &frequencyCounter{expiresAt: now.Add(window)}
+		s.counters[key] = counter
+	}
+	if counter.count >= limit {
+		return false, nil
+	}
+	counter.count++
+	return true, nil
+}
+
+// takeScript increments a counter below its limit and starts its window on
+// the first impression. KEYS[1] counter; ARGV[1] window in milliseconds,
+// ARGV[2] limit. Returns 1 if the impression was counted.
+var takeScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+if count >= tonumber(ARGV[2]) then
+	return 0
+end
+if redis.call("INCR", KEYS[1]) == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// RedisFrequencyStore keeps counters in a Redis-protocol server shared by
+// all replicas.
+type RedisFrequencyStore struct {
+	client *redis.Client
+}
+
+func NewRedisFrequencyStore(client *redis.Client) *RedisFrequencyStore {
+	return &RedisFrequencyStore{client: client}
+}
+
+func (s *RedisFrequencyStore) Counts(ctx context.Context, keys []string) ([]int64, error) {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = frequencyKeyPrefix + key
+	}
+	values, err := s.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, len(keys))
+	for i, value := range values {
+		if str, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(str, 10, 64)
+		}
+	}
+	return counts, nil
+}
+
+func (s *RedisFrequencyStore) Take(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	taken, err := takeScript.Run(ctx, s.client, []string{frequencyKeyPrefix + key}, window.Milliseconds(), limit).Int()
+	return taken == 1, err
+}
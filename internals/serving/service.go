@@ -0,0 +1,283 @@
+// Package serving picks the ad to show a viewer and records the
+// impression.
+package serving
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lystage-proj/internals/budget"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/lifecycle"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/snapshot"
+	"lystage-proj/internals/tracking"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrNoFill is returned when no active ad matches the request.
+var ErrNoFill = errors.New("no eligible ad")
+
+type Service struct {
+	DB           *gorm.DB
+	signer       *tracking.Signer
+	refreshEvery time.Duration
+	frequency    FrequencyStore
+	capped       *cappedCounter
+	ledger       *budget.Ledger
+	pacer        *budget.Pacer
+	candidates   *snapshot.Value[[]*candidate]
+}
+
+// NewService creates the ad selection service. Active ads and today's
+// spend are reloaded at most every refreshEvery; a nil signer serves ads
+// without click tokens. frequency counts impressions for frequency caps,
+// and ledger charges impressions of ads priced per impression. Capped
+// requests are flushed to serving_rollups in background until it stops.
+func NewService(background *lifecycle.Group, signer *tracking.Signer, refreshEvery time.Duration, frequency FrequencyStore, ledger *budget.Ledger) *Service {
+	s := &Service{
+		DB:           db.GormDB,
+		signer:       signer,
+		refreshEvery: refreshEvery,
+		frequency:    frequency,
+		capped:       newCappedCounter(db.GormDB),
+		ledger:       ledger,
+		pacer:        budget.NewPacer(db.GormDB, refreshEvery),
+	}
+	s.candidates = snapshot.New("active ads", refreshEvery, s.loadCandidates)
+	background.Go(s.capped.Run)
+	return s
+}
+
+// Select picks one of the active ads matching req that are within their
+// flight and daily budget pace and that the viewer has not seen up to their frequency
+// cap, weighted by models.Ad.Weight, and records an impression of it. Ads
+// with active variants show one of them, picked by variant weight.
+func (s *Service) Select(ctx context.Context, req Request) (*Selection, error) {
+	candidates, err := s.activeAds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	matching := make([]*candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if !c.matches(req, now) {
+			continue
+		}
+		if !s.pacer.Allow(ctx, &c.ad, now) {
+			observability.AdsPaced.Inc()
+			continue
+		}
+		matching = append(matching, c)
+	}
+
+	eligible := s.applyFrequencyCaps(ctx, req, matching, now)
+	chosen := s.choose(ctx, req, eligible, now)
+	if chosen == nil {
+		if len(matching) > 0 {
+			observability.AdRequestsCapped.Inc()
+		}
+		return nil, ErrNoFill
+	}
+
+	variant := chosen.pickVariant()
+	impressionID := uuid.New()
+	if err := s.recordImpression(ctx, chosen.ad.ID, variant, impressionID, req); err != nil {
+		return nil, err
+	}
+	s.ledger.RecordImpression(ctx, chosen.ad.ID, now)
+
+	selection := &Selection{
+		AdID:         chosen.ad.ID,
+		Title:        chosen.ad.Title,
+		ImageURL:     chosen.ad.ImageURL,
+		ImpressionID: impressionID.String(),
+	}
+	var variantID uint
+	if variant != nil {
+		variantID = variant.ID
+		selection.VariantID = &variant.ID
+		selection.ImageURL = variant.ImageURL
+		if variant.Title != "" {
+			selection.Title = variant.Title
+		}
+	}
+	if s.signer != nil {
+		token, issued := s.signer.Issue(chosen.ad.ID, variantID, impressionID)
+		selection.ClickToken = token
+		selection.ClickURL = "/c/" + token
+		selection.TokenExpiresAt = &issued.ExpiresAt
+	}
+	return selection, nil
+}
+
+// applyFrequencyCaps drops the ads the viewer has reached the cap of,
+// counting each in serving_rollups. If the counters cannot be read, caps
+// are not enforced rather than failing the request.
+func (s *Service) applyFrequencyCaps(ctx context.Context, req Request, matching []*candidate, now time.Time) []*candidate {
+	var (
+		capped []*candidate
+		keys   []string
+	)
+	for _, c := range matching {
+		if c.frequencyCap > 0 {
+			capped = append(capped, c)
+			keys = append(keys, frequencyKey(c, req))
+		}
+	}
+	if len(keys) == 0 {
+		return matching
+	}
+
+	counts, err := s.frequency.Counts(ctx, keys)
+	if err != nil {
+		observability.Logger.Warn("Failed to read frequency caps, serving uncapped", zap.Error(err))
+		return matching
+	}
+
+	reached := make(map[*candidate]bool)
+	for i, c := range capped {
+		if counts[i] >= int64(c.frequencyCap) {
+			reached[c] = true
+			s.capped.Add(c.ad.ID, now)
+			observability.AdsCapped.Inc()
+		}
+	}
+
+	eligible := make([]*candidate, 0, len(matching))
+	for _, c := range matching {
+		if !reached[c] {
+			eligible = append(eligible, c)
+		}
+	}
+	return eligible
+}
+
+// choose picks one of eligible at random in proportion to its weight and
+// counts the impression towards its frequency cap. Counting before the
+// impression is recorded keeps concurrent requests from serving past the
+// cap; an ad another request has taken to its cap since the counts were
+// read is dropped and the pick repeated. Returns nil if none is left.
+func (s *Service) choose(ctx context.Context, req Request, eligible []*candidate, now time.Time) *candidate {
+	for len(eligible) > 0 {
+		chosen := pickWeighted(eligible)
+		if chosen.frequencyCap == 0 {
+			return chosen
+		}
+
+		taken, err := s.frequency.Take(ctx, frequencyKey(chosen, req), int64(chosen.frequencyCap), chosen.frequencyWindow)
+		if err != nil {
+			observability.Logger.Warn("Failed to count impression towards frequency cap, serving uncapped",
+				zap.Error(err),
+				zap.Uint("ad_id", chosen.ad.ID))
+			return chosen
+		}
+		if taken {
+			return chosen
+		}
+
+		s.capped.Add(chosen.ad.ID, now)
+		observability.AdsCapped.Inc()
+		remaining := make([]*candidate, 0, len(eligible)-1)
+		for _, c := range eligible {
+			if c != chosen {
+				remaining = append(remaining, c)
+			}
+		}
+		eligible = remaining
+	}
+	return nil
+}
+
+// pickWeighted picks one of candidates at random in proportion to its
+// weight.
+func pickWeighted(candidates []*candidate) *candidate {
+	totalWeight := 0
+	for _, c := range candidates {
+		totalWeight += c.weight
+	}
+
+	pick := rand.IntN(totalWeight)
+	for _, c := range candidates {
+		if pick < c.weight {
+			return c
+		}
+		pick -= c.weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// frequencyKey identifies a viewer's impressions of an ad: their visitor
+// id, or their IP without one.
+func frequencyKey(c *candidate, req Request) string {
+	viewer := "v:" + req.VisitorID
+	if req.VisitorID == "" {
+		viewer = "i:" + req.UserIP
+	}
+	return fmt.Sprintf("%d:%s", c.ad.ID, viewer)
+}
+
+func (s *Service) recordImpression(ctx context.Context, adID uint, variant *models.AdVariant, impressionID uuid.UUID, req Request) error {
+	impression := models.Impression{
+		EventID:   impressionID,
+		AdID:      adID,
+		UserIP:    req.UserIP,
+		UserAgent: req.UserAgent,
+		VisitorID: req.VisitorID,
+		Placement: req.Placement,
+	}
+	if variant != nil {
+		impression.VariantID = &variant.ID
+	}
+	if err := s.DB.WithContext(ctx).Create(&impression).Error; err != nil {
+		return fmt.Errorf("record impression: %w", err)
+	}
+	return nil
+}
+
+// activeAds returns the parsed active ads, which are reloaded in the
+// background once they are older than refreshEvery. If a reload fails the
+// previous set is kept.
+func (s *Service) activeAds(ctx context.Context) ([]*candidate, error) {
+	candidates, err := s.candidates.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load active ads: %w", err)
+	}
+	return candidates, nil
+}
+
+func (s *Service) loadCandidates(ctx context.Context) ([]*candidate, error) {
+	// Ads of a campaign only run while it and its advertiser are active
+	var ads []models.Ad
+	err := s.DB.WithContext(ctx).
+		Preload("Campaign").
+		Preload("Variants", "status = ?", "active").
+		Joins("LEFT JOIN campaigns ON campaigns.id = ads.campaign_id").
+		Joins("LEFT JOIN advertisers ON advertisers.id = campaigns.advertiser_id").
+		Where("ads.status = ?", "active").
+		Where("ads.campaign_id IS NULL OR (campaigns.status = ? AND advertisers.status = ?)", "active", "active").
+		Find(&ads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*candidate, 0, len(ads))
+	for _, ad := range ads {
+		c, err := newCandidate(ad)
+		if err != nil {
+			observability.Logger.Warn("Skipping ad with invalid targeting",
+				zap.Error(err),
+				zap.Uint("ad_id", ad.ID))
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
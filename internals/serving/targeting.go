@@ -0,0 +1,122 @@
+package serving
+
+import (
+	"fmt"
+	"lystage-proj/internals/flight"
+	"lystage-proj/internals/models"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// candidate is an active ad with its targeting rules parsed.
+type candidate struct {
+	ad         models.Ad
+	weight     int
+	geos       map[string]bool // Countries (IN) and country-regions (IN-KA)
+	devices    map[string]bool
+	placements map[string]bool
+	hours      *[24]bool // Allowed local hours; nil for all day
+	location   *time.Location
+	flights    flight.Flights
+
+	frequencyCap    int // Impressions per visitor per window; 0 is uncapped
+	frequencyWindow time.Duration
+
+	variants      []models.AdVariant // Active creative variants
+	variantWeight int
+}
+
+// newCandidate parses an ad's targeting columns.
+func newCandidate(ad models.Ad) (*candidate, error) {
+	c := &candidate{
+		ad:         ad,
+		weight:     ad.Weight,
+		geos:       parseSet(ad.TargetGeos, strings.ToUpper),
+		devices:    parseSet(ad.TargetDevices, strings.ToLower),
+		placements: parseSet(ad.TargetPlacements, strings.ToLower),
+		location:   time.UTC,
+
+		frequencyCap:    ad.FrequencyCap,
+		frequencyWindow: time.Duration(ad.FrequencyCapWindowSecs) * time.Second,
+	}
+	if c.weight <= 0 {
+		c.weight = 1
+	}
+	for _, variant := range ad.Variants {
+		if variant.Weight > 0 {
+			c.variants = append(c.variants, variant)
+			c.variantWeight += variant.Weight
+		}
+	}
+	if c.frequencyCap > 0 && c.frequencyWindow <= 0 {
+		return nil, fmt.Errorf("frequency_cap_window_secs must be positive")
+	}
+
+	if ad.TargetTimezone != "" {
+		location, err := time.LoadLocation(ad.TargetTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("target_timezone: %w", err)
+		}
+		c.location = location
+	}
+
+	if ad.TargetHours != "" {
+		hours, err := flight.ParseHours(ad.TargetHours)
+		if err != nil {
+			return nil, fmt.Errorf("target_hours: %w", err)
+		}
+		c.hours = hours
+	}
+
+	flights, err := flight.ForAdAndCampaign(ad)
+	if err != nil {
+		return nil, err
+	}
+	c.flights = flights
+	return c, nil
+}
+
+// matches reports whether the ad may be shown for req at now.
+func (c *candidate) matches(req Request, now time.Time) bool {
+	if len(c.geos) > 0 && !c.geos[req.Country] && !c.geos[req.Country+"-"+req.Region] {
+		return false
+	}
+	if len(c.devices) > 0 && !c.devices[req.DeviceType] {
+		return false
+	}
+	if len(c.placements) > 0 && !c.placements[req.Placement] {
+		return false
+	}
+	if c.hours != nil && !c.hours[now.In(c.location).Hour()] {
+		return false
+	}
+	return c.flights.Contains(now)
+}
+
+// pickVariant picks one of the ad's variants in proportion to their
+// weights, or nil if it has none.
+func (c *candidate) pickVariant() *models.AdVariant {
+	if len(c.variants) == 0 {
+		return nil
+	}
+	pick := rand.IntN(c.variantWeight)
+	for i := range c.variants {
+		if pick < c.variants[i].Weight {
+			return &c.variants[i]
+		}
+		pick -= c.variants[i].Weight
+	}
+	return &c.variants[len(c.variants)-1]
+}
+
+// parseSet splits a comma-separated list into a set of normalized values.
+func parseSet(list string, normalize func(string) string) map[string]bool {
+	set := make(map[string]bool)
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			set[normalize(value)] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,26 @@
+package serving
+
+import "time"
+
+// Request describes the viewer and slot an ad is selected for.
+type Request struct {
+	Placement  string
+	VisitorID  string
+	UserIP     string
+	UserAgent  string
+	Country    string // Derived from UserIP
+	Region     string
+	DeviceType string // Derived from UserAgent
+}
+
+// Selection is the ad chosen for a request and how to track it.
+type Selection struct {
+	AdID           uint       `json:"ad_id"`
+	VariantID      *uint      `json:"variant_id,omitempty"` // Creative shown, for ads with variants
+	Title          string     `json:"title"`
+	ImageURL       string     `json:"image_url"`
+	ImpressionID   string     `json:"impression_id"`
+	ClickToken     string     `json:"click_token,omitempty"`
+	ClickURL       string     `json:"click_url,omitempty"` // Tracking link, relative to the API host
+	TokenExpiresAt *time.Time `json:"click_token_expires_at,omitempty"`
+}
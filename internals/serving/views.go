@@ -0,0 +1,83 @@
+package serving
+
+import (
+	"context"
+	"errors"
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/enrich"
+	"lystage-proj/internals/observability"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	visitorIDHeader    = "X-Visitor-ID"
+	visitorIDCookie    = "lv_vid"
+	maxVisitorIDLength = 128
+	maxPlacementLength = 100
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// ServeAd handles GET /ads/serve: it picks an ad for the calling viewer
+// and placement, records the impression and returns the creative with its
+// click token. Requests without an eligible ad get 204.
+func (h *Handler) ServeAd(c *gin.Context) {
+	req := Request{
+		Placement: strings.ToLower(strings.TrimSpace(c.Query("placement"))),
+		VisitorID: c.Query("visitor_id"),
+		UserIP:    c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+	}
+	if req.VisitorID == "" {
+		req.VisitorID = c.GetHeader(visitorIDHeader)
+	}
+	if req.VisitorID == "" {
+		if cookie, err := c.Cookie(visitorIDCookie); err == nil {
+			req.VisitorID = cookie
+		}
+	}
+	if len(req.VisitorID) > maxVisitorIDLength || len(req.Placement) > maxPlacementLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visitor_id or placement too long"})
+		return
+	}
+
+	// Crawlers would only inflate impressions
+	dims := enrich.Resolve(req.UserAgent, req.UserIP)
+	if dims.IsBot {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	req.Country, req.Region, req.DeviceType = dims.Country, dims.Region, dims.DeviceType
+
+	selection, err := h.service.Select(c.Request.Context(), req)
+	switch {
+	case errors.Is(err, ErrNoFill):
+		c.Status(http.StatusNoContent)
+		return
+	case errors.Is(err, context.Canceled):
+		c.Status(config.StatusClientClosedRequest)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Ad selection timed out"})
+		return
+	case err != nil:
+		observability.Logger.Error("Failed to select ad",
+			zap.Error(err),
+			zap.String("placement", req.Placement))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select ad"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, selection)
+}
@@ -0,0 +1,151 @@
+package sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const histogramVersion = 1
+
+// PlaybackBuckets are the lower bounds, in seconds, of the playback time
+// histogram buckets. They are dense at the start where most viewers drop
+// off; the last bucket is open-ended. Changing them invalidates stored
+// histograms.
+var PlaybackBuckets = []float64{0, 1, 2, 3, 4, 5, 7.5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 300, 600}
+
+// Histogram counts values into fixed buckets. Histograms over the same
+// bounds merge exactly, so quantiles can be computed over any combination
+// of rollups; quantile accuracy is limited to the bucket width.
+type Histogram struct {
+	bounds []float64
+	counts []int64
+}
+
+// NewHistogram returns an empty histogram whose bucket i covers
+// [bounds[i], bounds[i+1]). Values below bounds[0] fall into bucket 0.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+// BucketIndex returns the bucket a value falls into.
+func (h *Histogram) BucketIndex(value float64) int {
+	i := sort.SearchFloat64s(h.bounds, value)
+	if i == len(h.bounds) || h.bounds[i] != value {
+		i--
+	}
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+// Add records a value.
+func (h *Histogram) Add(value float64) {
+	h.counts[h.BucketIndex(value)]++
+}
+
+// AddCount records n values in the given bucket.
+func (h *Histogram) AddCount(bucket int, n int64) {
+	if bucket < 0 {
+		bucket = 0
+	}
+	if bucket >= len(h.counts) {
+		bucket = len(h.counts) - 1
+	}
+	h.counts[bucket] += n
+}
+
+// Merge folds other into h. Both must use the same bounds.
+func (h *Histogram) Merge(other *Histogram) error {
+	if len(other.counts) != len(h.counts) {
+		return errors.New("histogram: bucket count mismatch")
+	}
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	return nil
+}
+
+// Total returns the number of recorded values.
+func (h *Histogram) Total() int64 {
+	var total int64
+	for _, n := range h.counts {
+		total += n
+	}
+	return total
+}
+
+// Quantile returns the value below which a fraction q of recorded values
+// fall, interpolating linearly within the bucket. Values in the open-ended
+// last bucket are reported at its lower bound.
+func (h *Histogram) Quantile(q float64) float64 {
+	total := h.Total()
+	if total == 0 {
+		return 0
+	}
+
+	target := q * float64(total)
+	var cumulative float64
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+		if cumulative+float64(n) >= target {
+			lower := h.bounds[i]
+			if i == len(h.bounds)-1 {
+				return lower
+			}
+			upper := h.bounds[i+1]
+			return lower + (upper-lower)*(target-cumulative)/float64(n)
+		}
+		cumulative += float64(n)
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// MarshalBinary encodes the histogram as a version byte, a uvarint bucket
+// count and a uvarint per bucket.
+func (h *Histogram) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 1, 1+binary.MaxVarintLen64*(len(h.counts)+1))
+	out[0] = histogramVersion
+	out = binary.AppendUvarint(out, uint64(len(h.counts)))
+	for _, n := range h.counts {
+		out = binary.AppendUvarint(out, uint64(n))
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a histogram produced by MarshalBinary into h,
+// which must have been created with the same bounds.
+func (h *Histogram) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("histogram: truncated data")
+	}
+	if data[0] != histogramVersion {
+		return fmt.Errorf("histogram: unsupported version %d", data[0])
+	}
+	data = data[1:]
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errors.New("histogram: truncated data")
+	}
+	if int(size) != len(h.bounds) {
+		return fmt.Errorf("histogram: expected %d buckets, got %d", len(h.bounds), size)
+	}
+	data = data[n:]
+
+	counts := make([]int64, size)
+	for i := range counts {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("histogram: truncated data")
+		}
+		counts[i] = int64(v)
+		data = data[n:]
+	}
+	h.counts = counts
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package sketch implements small mergeable summaries used to serve
+// analytics over long ranges from pre-aggregated rollups.
+package sketch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	hllVersion = 1
+
+	// HLLPrecision is the number of index bits. 2^12 registers take 4 KiB
+	// per sketch.
+	HLLPrecision = 12
+	hllRegisters = 1 << HLLPrecision
+
+	// HLLStdError is the relative standard error of an estimate,
+	// 1.04/sqrt(2^precision) ≈ 1.6%. Roughly 95% of estimates fall within
+	// two standard errors of the true count.
+	HLLStdError = 1.04 / 64
+)
+
+// HLL is a dense HyperLogLog sketch estimating the number of distinct
+// values added to it. Sketches with the same precision merge losslessly, so
+// per-bucket sketches can be combined for any range of buckets.
+type HLL struct {
+	registers []uint8
+}
+
+// NewHLL returns an empty sketch.
+func NewHLL() *HLL {
+	return &HLL{registers: make([]uint8, hllRegisters)}
+}
+
+// Add records a value.
+func (h *HLL) Add(value []byte) {
+	h.addHash(xxhash.Sum64(value))
+}
+
+// AddString records a string value.
+func (h *HLL) AddString(value string) {
+	h.addHash(xxhash.Sum64String(value))
+}
+
+func (h *HLL) addHash(hash uint64) {
+	index := hash >> (64 - HLLPrecision)
+	// Rank is the position of the first set bit in the remaining bits; the
+	// sentinel bit caps it when they are all zero.
+	rest := hash<<HLLPrecision | 1<<(HLLPrecision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Merge folds other into h, after which h estimates the union of both.
+func (h *HLL) Merge(other *HLL) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Estimate returns the approximate number of distinct values added.
+func (h *HLL) Estimate() uint64 {
+	const m = float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+
+	// Linear counting is far more accurate while many registers are empty.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary encodes the sketch as a version byte, a precision byte and
+// the registers.
+func (h *HLL) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 2+len(h.registers))
+	out[0] = hllVersion
+	out[1] = HLLPrecision
+	copy(out[2:], h.registers)
+	return out, nil
+}
+
+// UnmarshalBinary decodes a sketch produced by MarshalBinary.
+func (h *HLL) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return errors.New("hll: truncated sketch")
+	}
+	if data[0] != hllVersion {
+		return fmt.Errorf("hll: unsupported version %d", data[0])
+	}
+	if data[1] != HLLPrecision || len(data) != 2+hllRegisters {
+		return fmt.Errorf("hll: unsupported precision %d", data[1])
+	}
+
+	h.registers = make([]uint8, hllRegisters)
+	copy(h.registers, data[2:])
+	return nil
+}
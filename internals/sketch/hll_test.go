@@ -0,0 +1,43 @@
+package sketch
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHLLEstimateWithinThreeStdErrors(t *testing.T) {
+	for _, n := range []int{100, 1000, 10000, 100000} {
+		h := NewHLL()
+		for i := 0; i < n; i++ {
+			value := "visitor-" + strconv.Itoa(i)
+			h.AddString(value)
+			h.AddString(value) // Duplicates do not count
+		}
+
+		estimate := float64(h.Estimate())
+		if relErr := math.Abs(estimate-float64(n)) / float64(n); relErr > 3*HLLStdError {
+			t.Errorf("n = %d: estimate %.0f is off by %.2f%%, more than 3σ (%.2f%%)",
+				n, estimate, relErr*100, 3*HLLStdError*100)
+		}
+	}
+}
+
+func TestHLLMergeMatchesUnion(t *testing.T) {
+	a, b, union := NewHLL(), NewHLL(), NewHLL()
+	for i := 0; i < 20000; i++ {
+		value := strconv.Itoa(i)
+		if i < 12000 {
+			a.AddString(value)
+		}
+		if i >= 8000 {
+			b.AddString(value)
+		}
+		union.AddString(value)
+	}
+
+	a.Merge(b)
+	if a.Estimate() != union.Estimate() {
+		t.Fatalf("merged estimate %d, want %d", a.Estimate(), union.Estimate())
+	}
+}
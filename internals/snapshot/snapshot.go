@@ -0,0 +1,109 @@
+// Package snapshot keeps data loaded from the database for hot paths.
+// Readers get the last loaded copy at once while a stale one is reloaded
+// in the background, so requests only wait on the database for the first
+// load.
+package snapshot
+
+import (
+	"context"
+	"lystage-proj/internals/observability"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// loadTimeout bounds each load, which runs detached from the request that
+// started it.
+const loadTimeout = 10 * time.Second
+
+// Value is a snapshot reloaded at most every maxAge.
+type Value[T any] struct {
+	name   string
+	maxAge time.Duration
+	load   func(ctx context.Context) (T, error)
+
+	mu       sync.Mutex
+	value    T
+	loaded   bool          // Whether a load has succeeded
+	err      error         // Of the last load, while none has succeeded
+	loadedAt time.Time     // Of the last load; zero retries at once
+	loading  bool          // Whether a reload is running
+	first    chan struct{} // Closed once the first load has finished
+}
+
+// New returns a snapshot of what load returns. name identifies it in logs.
+func New[T any](name string, maxAge time.Duration, load func(ctx context.Context) (T, error)) *Value[T] {
+	return &Value[T]{name: name, maxAge: maxAge, load: load, first: make(chan struct{})}
+}
+
+// Get returns the last loaded value, starting a reload in the background
+// once it is older than maxAge. Until the first load has finished it waits
+// for it, up to ctx. If a reload fails the previous value is kept until
+// the next one; an error is only returned while no load has succeeded.
+func (v *Value[T]) Get(ctx context.Context) (T, error) {
+	v.mu.Lock()
+	if v.loadedAt.IsZero() || time.Since(v.loadedAt) >= v.maxAge {
+		v.start()
+	}
+	v.mu.Unlock()
+
+	select {
+	case <-v.first:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.value, v.err
+}
+
+// Refresh starts a reload now, for a value known to be out of date.
+func (v *Value[T]) Refresh() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.start()
+}
+
+// start runs a reload unless one is running; callers must hold v.mu.
+func (v *Value[T]) start() {
+	if v.loading {
+		return
+	}
+	v.loading = true
+	go v.reload()
+}
+
+func (v *Value[T]) reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	value, err := v.load(ctx)
+	cancel()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.loading = false
+	switch {
+	case err == nil:
+		v.value, v.loaded, v.err = value, true, nil
+		v.loadedAt = time.Now()
+	case v.loaded:
+		observability.Logger.Warn("Failed to reload snapshot, keeping the previous one",
+			zap.Error(err),
+			zap.String("snapshot", v.name))
+		v.loadedAt = time.Now()
+	default:
+		observability.Logger.Warn("Failed to load snapshot",
+			zap.Error(err),
+			zap.String("snapshot", v.name))
+		v.err = err
+	}
+
+	select {
+	case <-v.first:
+	default:
+		close(v.first)
+	}
+}
@@ -0,0 +1,23 @@
+package tracking
+
+import (
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/db"
+)
+
+// NewSignerFromConfig returns the click token signer, or nil when no
+// CLICK_TOKEN_SECRET is set and clicks are accepted unsigned.
+func NewSignerFromConfig(cfg *config.Config) *Signer {
+	if cfg.ClickTokenSecret == "" {
+		return nil
+	}
+	return NewSigner(cfg.ClickTokenSecret, cfg.ClickTokenTTL)
+}
+
+// NewReplayGuardFromConfig returns the used-token store selected in cfg.
+func NewReplayGuardFromConfig(cfg *config.Config) ReplayGuard {
+	if cfg.ClickTokenBackend == "redis" {
+		return NewRedisReplayGuard(db.Redis)
+	}
+	return NewMemoryReplayGuard()
+}
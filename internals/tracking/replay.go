@@ -0,0 +1,85 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrReplayedToken is returned when a token's impression was already
+// clicked.
+var ErrReplayedToken = errors.New("click token already used")
+
+const replayKeyPrefix = "lvstage:click-token:"
+
+// ReplayGuard remembers used tokens until they expire. Claim reports
+// whether token is being used for the first time. Release forgets a
+// claimed token, so a click that could not be recorded can be sent again.
+type ReplayGuard interface {
+	Claim(ctx context.Context, token Token) (bool, error)
+	Release(ctx context.Context, token Token) error
+}
+
+// MemoryReplayGuard remembers tokens used on this replica only.
+type MemoryReplayGuard struct {
+	mu     sync.Mutex
+	used   map[uuid.UUID]time.Time // Impression ID to token expiry
+	claims int
+}
+
+func NewMemoryReplayGuard() *MemoryReplayGuard {
+	return &MemoryReplayGuard{used: make(map[uuid.UUID]time.Time)}
+}
+
+func (g *MemoryReplayGuard) Claim(_ context.Context, token Token) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if g.claims++; g.claims%1000 == 0 {
+		for id, expiresAt := range g.used {
+			if now.After(expiresAt) {
+				delete(g.used, id)
+			}
+		}
+	}
+
+	if expiresAt, ok := g.used[token.ImpressionID]; ok && !now.After(expiresAt) {
+		return false, nil
+	}
+	g.used[token.ImpressionID] = token.ExpiresAt
+	return true, nil
+}
+
+func (g *MemoryReplayGuard) Release(_ context.Context, token Token) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.used, token.ImpressionID)
+	return nil
+}
+
+// RedisReplayGuard remembers used tokens in a Redis-protocol server shared
+// by all replicas.
+type RedisReplayGuard struct {
+	client *redis.Client
+}
+
+func NewRedisReplayGuard(client *redis.Client) *RedisReplayGuard {
+	return &RedisReplayGuard{client: client}
+}
+
+func (g *RedisReplayGuard) Claim(ctx context.Context, token Token) (bool, error) {
+	ttl := time.Until(token.ExpiresAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	return g.client.SetNX(ctx, replayKeyPrefix+token.ImpressionID.String(), 1, ttl).Result()
+}
+
+func (g *RedisReplayGuard) Release(ctx context.Context, token Token) error {
+	return g.client.Del(ctx, replayKeyPrefix+token.ImpressionID.String()).Err()
+}
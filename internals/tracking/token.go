@@ -0,0 +1,131 @@
+// Package tracking issues and verifies the signed tokens that tie a click
+// to the impression it came from.
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Token verification errors.
+var (
+	ErrInvalidToken = errors.New("invalid click token")
+	ErrExpiredToken = errors.New("click token expired")
+)
+
+const (
+	tokenVersion  = 2
+	payloadLength = 1 + 8 + 8 + 16 + 8 // version, ad ID, variant ID, impression ID, expiry
+	signatureSize = 16                 // Truncated HMAC-SHA256
+
+	// Version 1 tokens have no variant ID; they are accepted until the
+	// last ones issued expire
+	v1TokenVersion  = 1
+	v1PayloadLength = 1 + 8 + 16 + 8
+)
+
+var encoding = base64.RawURLEncoding
+
+// Token is what a click token vouches for: the ad was served as the
+// impression and may be clicked until ExpiresAt. VariantID is the creative
+// served, or 0 for the ad's own.
+type Token struct {
+	AdID         uint
+	VariantID    uint
+	ImpressionID uuid.UUID
+	ExpiresAt    time.Time
+}
+
+// Signer issues and verifies click tokens. All replicas must share the
+// secret.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSigner creates a signer whose tokens are valid for ttl.
+func NewSigner(secret string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), ttl: ttl}
+}
+
+// TTL is how long issued tokens stay valid.
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue signs a token for an impression of adID showing variantID (0 for
+// none).
+func (s *Signer) Issue(adID, variantID uint, impressionID uuid.UUID) (string, Token) {
+	token := Token{
+		AdID:         adID,
+		VariantID:    variantID,
+		ImpressionID: impressionID,
+		ExpiresAt:    time.Now().Add(s.ttl).Truncate(time.Second),
+	}
+
+	payload := make([]byte, payloadLength)
+	payload[0] = tokenVersion
+	binary.BigEndian.PutUint64(payload[1:9], uint64(adID))
+	binary.BigEndian.PutUint64(payload[9:17], uint64(variantID))
+	copy(payload[17:33], impressionID[:])
+	binary.BigEndian.PutUint64(payload[33:41], uint64(token.ExpiresAt.Unix()))
+
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(s.sign(payload)), token
+}
+
+// Verify checks a token's signature and expiry.
+func (s *Signer) Verify(raw string) (Token, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(raw, ".")
+	if !ok {
+		return Token{}, ErrInvalidToken
+	}
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return Token{}, ErrInvalidToken
+	}
+	token, ok := decodePayload(payload)
+	if !ok {
+		return Token{}, ErrInvalidToken
+	}
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, s.sign(payload)) {
+		return Token{}, ErrInvalidToken
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return token, ErrExpiredToken
+	}
+	return token, nil
+}
+
+// decodePayload reads a token of the current version or of version 1.
+func decodePayload(payload []byte) (Token, bool) {
+	var token Token
+	switch {
+	case len(payload) == payloadLength && payload[0] == tokenVersion:
+		token.AdID = uint(binary.BigEndian.Uint64(payload[1:9]))
+		token.VariantID = uint(binary.BigEndian.Uint64(payload[9:17]))
+		copy(token.ImpressionID[:], payload[17:33])
+		token.ExpiresAt = time.Unix(int64(binary.BigEndian.Uint64(payload[33:41])), 0)
+	case len(payload) == v1PayloadLength && payload[0] == v1TokenVersion:
+		token.AdID = uint(binary.BigEndian.Uint64(payload[1:9]))
+		copy(token.ImpressionID[:], payload[9:25])
+		token.ExpiresAt = time.Unix(int64(binary.BigEndian.Uint64(payload[25:33])), 0)
+	default:
+		return token, false
+	}
+	return token, true
+}
+
+func (s *Signer) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:signatureSize]
+}
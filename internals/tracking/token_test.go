@@ -0,0 +1,66 @@
+package tracking
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// issueV1 signs a version 1 token, as issued before variants existed.
+func issueV1(s *Signer, adID uint, impressionID uuid.UUID, expiresAt time.Time) string {
+	payload := make([]byte, v1PayloadLength)
+	payload[0] = v1TokenVersion
+	binary.BigEndian.PutUint64(payload[1:9], uint64(adID))
+	copy(payload[9:25], impressionID[:])
+	binary.BigEndian.PutUint64(payload[25:33], uint64(expiresAt.Unix()))
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(s.sign(payload))
+}
+
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner("s3cret", time.Hour)
+	impressionID := uuid.New()
+	valid, _ := signer.Issue(7, 3, impressionID)
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	// Flip one bit of the ad ID, keeping the signature
+	tampered, _ := encoding.DecodeString(payload)
+	tampered[8] ^= 1
+
+	expired, _ := NewSigner("s3cret", -time.Minute).Issue(7, 3, impressionID)
+	foreign, _ := NewSigner("other", time.Hour).Issue(7, 3, impressionID)
+
+	for _, tc := range []struct {
+		name      string
+		raw       string
+		err       error
+		adID      uint
+		variantID uint
+	}{
+		{"v2", valid, nil, 7, 3},
+		{"v1", issueV1(signer, 9, impressionID, time.Now().Add(time.Hour)), nil, 9, 0},
+		{"expired v2", expired, ErrExpiredToken, 7, 3},
+		{"expired v1", issueV1(signer, 9, impressionID, time.Now().Add(-time.Minute)), ErrExpiredToken, 9, 0},
+		{"tampered payload", encoding.EncodeToString(tampered) + "." + signature, ErrInvalidToken, 0, 0},
+		{"tampered signature", payload + "." + encoding.EncodeToString(make([]byte, signatureSize)), ErrInvalidToken, 0, 0},
+		{"other secret", foreign, ErrInvalidToken, 0, 0},
+		{"no signature", payload, ErrInvalidToken, 0, 0},
+		{"not base64", "!!." + signature, ErrInvalidToken, 0, 0},
+		{"unknown version", encoding.EncodeToString([]byte{9, 0, 0}) + "." + signature, ErrInvalidToken, 0, 0},
+	} {
+		token, err := signer.Verify(tc.raw)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if token.AdID != tc.adID || token.VariantID != tc.variantID {
+			t.Errorf("%s: ad %d variant %d, want ad %d variant %d", tc.name, token.AdID, token.VariantID, tc.adID, tc.variantID)
+		}
+		if tc.adID != 0 && token.ImpressionID != impressionID {
+			t.Errorf("%s: impression %s, want %s", tc.name, token.ImpressionID, impressionID)
+		}
+	}
+}
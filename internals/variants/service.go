@@ -0,0 +1,131 @@
+// Package variants manages the creative variants of ads under A/B test.
+package variants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidRequest  = errors.New("invalid request")
+	errAdNotFound      = errors.New("ad not found")
+	errVariantNotFound = errors.New("variant not found")
+)
+
+type Service struct {
+	DB *gorm.DB
+}
+
+func NewService() *Service {
+	return &Service{DB: db.GormDB}
+}
+
+// variantFromRequest validates req and applies it to variant.
+func variantFromRequest(req VariantRequest, variant *models.AdVariant) error {
+	if req.Status == "" {
+		req.Status = StatusActive
+	}
+	if req.Status != StatusActive && req.Status != StatusPaused {
+		return fmt.Errorf("unknown status %q", req.Status)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	weight := 1
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+	if weight < 0 {
+		return fmt.Errorf("weight must not be negative")
+	}
+
+	variant.Name = strings.TrimSpace(req.Name)
+	variant.Title = req.Title
+	variant.ImageURL = req.ImageURL
+	variant.TargetURL = req.TargetURL
+	variant.Weight = weight
+	variant.Status = req.Status
+	return nil
+}
+
+// checkAd returns errAdNotFound unless the ad exists.
+func (s *Service) checkAd(ctx context.Context, adID uint) error {
+	var count int64
+	if err := s.DB.WithContext(ctx).Model(&models.Ad{}).Where("id = ?", adID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errAdNotFound
+	}
+	return nil
+}
+
+func (s *Service) CreateVariant(ctx context.Context, adID uint, req VariantRequest) (*models.AdVariant, error) {
+	variant := &models.AdVariant{AdID: adID}
+	if err := variantFromRequest(req, variant); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if err := s.checkAd(ctx, adID); err != nil {
+		return nil, err
+	}
+	if err := s.DB.WithContext(ctx).Create(variant).Error; err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// ListVariants returns an ad's variants, oldest first.
+func (s *Service) ListVariants(ctx context.Context, adID uint) ([]models.AdVariant, error) {
+	if err := s.checkAd(ctx, adID); err != nil {
+		return nil, err
+	}
+
+	var variants []models.AdVariant
+	err := s.DB.WithContext(ctx).Where("ad_id = ?", adID).Order("id").Find(&variants).Error
+	return variants, err
+}
+
+func (s *Service) GetVariant(ctx context.Context, adID, id uint) (*models.AdVariant, error) {
+	var variant models.AdVariant
+	err := s.DB.WithContext(ctx).Where("ad_id = ?", adID).First(&variant, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errVariantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (s *Service) UpdateVariant(ctx context.Context, adID, id uint, req VariantRequest) (*models.AdVariant, error) {
+	variant, err := s.GetVariant(ctx, adID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := variantFromRequest(req, variant); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if err := s.DB.WithContext(ctx).Save(variant).Error; err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// DeleteVariant removes a variant. Impressions and clicks recorded for it
+// keep its ID.
+func (s *Service) DeleteVariant(ctx context.Context, adID, id uint) error {
+	result := s.DB.WithContext(ctx).Where("ad_id = ?", adID).Delete(&models.AdVariant{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVariantNotFound
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package variants
+
+// Variant statuses; only active variants are served.
+const (
+	StatusActive = "active"
+	StatusPaused = "paused"
+)
+
+// VariantRequest creates or replaces a creative variant. Status defaults
+// to active and Weight to 1; a weight of 0 holds the variant out of
+// traffic. Empty Title and TargetURL fall back to the ad's.
+type VariantRequest struct {
+	Name      string `json:"name" binding:"required,max=100"`
+	Title     string `json:"title" binding:"max=255"`
+	ImageURL  string `json:"image_url" binding:"required,url,max=500"`
+	TargetURL string `json:"target_url" binding:"omitempty,url,max=500"`
+	Weight    *int   `json:"weight"`
+	Status    string `json:"status"`
+}
@@ -0,0 +1,138 @@
+package variants
+
+import (
+	"errors"
+	"lystage-proj/internals/observability"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// CreateVariant handles POST /ads/:id/variants.
+func (h *Handler) CreateVariant(c *gin.Context) {
+	adID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req VariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	variant, err := h.service.CreateVariant(c.Request.Context(), adID, req)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, variant)
+}
+
+// ListVariants handles GET /ads/:id/variants.
+func (h *Handler) ListVariants(c *gin.Context) {
+	adID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	variants, err := h.service.ListVariants(c.Request.Context(), adID)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": variants})
+}
+
+// GetVariant handles GET /ads/:id/variants/:variant_id.
+func (h *Handler) GetVariant(c *gin.Context) {
+	adID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "variant_id")
+	if !ok {
+		return
+	}
+
+	variant, err := h.service.GetVariant(c.Request.Context(), adID, id)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, variant)
+}
+
+// UpdateVariant handles PUT /ads/:id/variants/:variant_id.
+func (h *Handler) UpdateVariant(c *gin.Context) {
+	adID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "variant_id")
+	if !ok {
+		return
+	}
+
+	var req VariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	variant, err := h.service.UpdateVariant(c.Request.Context(), adID, id, req)
+	if !serviceError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, variant)
+}
+
+// DeleteVariant handles DELETE /ads/:id/variants/:variant_id.
+func (h *Handler) DeleteVariant(c *gin.Context) {
+	adID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "variant_id")
+	if !ok {
+		return
+	}
+
+	if !serviceError(c, h.service.DeleteVariant(c.Request.Context(), adID, id)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// serviceError writes the response for a service error and reports whether
+// the handler may continue.
+func serviceError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errInvalidRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errAdNotFound), errors.Is(err, errVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		observability.Logger.Error("Variant request failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+	}
+	return false
+}
+
+func parseID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 0)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const backfillBatchSize = 5000
+
+// BackfillRollups rebuilds the click_rollups rows of every hour in
+// [since, until) from stored clicks, replacing what is there, and returns
+// the number of rows written. It fills in hours from before the worker
+// maintained rollups. Hours the running aggregator may still be buffering
+// are refused: until must be at least an hour in the past.
+func BackfillRollups(ctx context.Context, since, until time.Time) (int, error) {
+	since = since.UTC().Truncate(rollupBucket)
+	until = until.UTC().Truncate(rollupBucket)
+	if latest := time.Now().UTC().Truncate(rollupBucket).Add(-rollupBucket); until.After(latest) {
+		return 0, fmt.Errorf("until must not be after %s", latest.Format(time.RFC3339))
+	}
+	if !since.Before(until) {
+		return 0, fmt.Errorf("since must be before until")
+	}
+
+	written := 0
+	for bucket := since; bucket.Before(until); bucket = bucket.Add(rollupBucket) {
+		rows, err := backfillBucket(ctx, bucket)
+		if err != nil {
+			return written, fmt.Errorf("backfill %s: %w", bucket.Format(time.RFC3339), err)
+		}
+		written += rows
+		observability.Logger.Debug("Backfilled click rollups",
+			zap.Time("bucket_start", bucket),
+			zap.Int("ads", rows))
+	}
+	return written, nil
+}
+
+// backfillBucket rebuilds one hour's rollups. Like the aggregator, it
+// leaves out flagged clicks.
+func backfillBucket(ctx context.Context, bucket time.Time) (int, error) {
+	buffers := make(map[rollupKey]*rollupBuffer)
+	var batch []models.Click
+	err := db.GormDB.WithContext(ctx).
+		Select("id", "ad_id", "user_ip", "fingerprint", "visitor_id", "playback_time_sec", "watched_percent", "created_at").
+		Where("created_at >= ? AND created_at < ? AND NOT is_fraudulent", bucket, bucket.Add(rollupBucket)).
+		FindInBatches(&batch, backfillBatchSize, func(_ *gorm.DB, _ int) error {
+			for _, click := range batch {
+				key := newRollupKey(click)
+				buf, ok := buffers[key]
+				if !ok {
+					buf = newRollupBuffer()
+					buffers[key] = buf
+				}
+				buf.add(click)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for key, buf := range buffers {
+		row, err := buf.rollup(key)
+		if err != nil {
+			return 0, err
+		}
+		err = db.GormDB.WithContext(ctx).
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "ad_id"}, {Name: "bucket_start"}},
+				UpdateAll: true,
+			}).
+			Create(row).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(buffers), nil
+}
+
+// rollup encodes the buffer as the complete row for key.
+func (buf *rollupBuffer) rollup(key rollupKey) (*models.ClickRollup, error) {
+	row := &models.ClickRollup{
+		AdID:        key.adID,
+		BucketStart: key.bucketStart,
+		Clicks:      buf.clicks,
+		Watched25:   buf.quartiles[0],
+		Watched50:   buf.quartiles[1],
+		Watched75:   buf.quartiles[2],
+		Watched100:  buf.quartiles[3],
+	}
+
+	var err error
+	if row.IPSketch, err = buf.ip.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if row.FingerprintSketch, err = buf.fingerprint.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if row.VisitorSketch, err = buf.visitor.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if row.PlaybackHistogram, err = buf.playback.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
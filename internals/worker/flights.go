@@ -0,0 +1,23 @@
+package worker
+
+import (
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/flight"
+	"lystage-proj/internals/leader"
+	"lystage-proj/internals/lifecycle"
+	"time"
+)
+
+// StartFlightScheduler starts pausing and resuming ads on their flights
+// until background stops. With Redis configured, replicas elect one of
+// them to do so.
+func StartFlightScheduler(background *lifecycle.Group, cfg *config.Config) {
+	var elector leader.Elector = leader.Always{}
+	if db.Redis != nil {
+		redisElector := leader.NewRedisElector(db.Redis, "flight-scheduler", 30*time.Second)
+		background.Go(redisElector.Run)
+		elector = redisElector
+	}
+	background.Go(flight.NewScheduler(db.GormDB, elector, cfg.FlightSchedulerInterval).Run)
+}
@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"lystage-proj/internals/config"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/leader"
+	"lystage-proj/internals/lifecycle"
+	"lystage-proj/internals/reports"
+	"time"
+)
+
+// StartReportWorkers starts the report pool, which runs jobs and sends
+// scheduled reports, and the schedule runner, which stop with background.
+// With Redis configured, replicas elect one of them to run schedules.
+func StartReportWorkers(background *lifecycle.Group, service *reports.Service, cfg *config.Config) {
+	background.Go(reports.NewPool(service, cfg.ReportWorkers, cfg.ReportJobTimeout, cfg.ReportRetention).Run)
+
+	var elector leader.Elector = leader.Always{}
+	if db.Redis != nil {
+		redisElector := leader.NewRedisElector(db.Redis, "report-scheduler", 30*time.Second)
+		background.Go(redisElector.Run)
+		elector = redisElector
+	}
+	background.Go(reports.NewScheduler(service, elector).Run)
+}
@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"context"
+	"lystage-proj/internals/db"
+	"lystage-proj/internals/models"
+	"lystage-proj/internals/observability"
+	"lystage-proj/internals/sketch"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	rollupBucket        = time.Hour
+	rollupFlushInterval = 30 * time.Second
+)
+
+type rollupKey struct {
+	adID        uint
+	bucketStart time.Time
+}
+
+// rollupBuffer accumulates clicks for one ad-hour between flushes.
+type rollupBuffer struct {
+	clicks      int64
+	ip          *sketch.HLL
+	fingerprint *sketch.HLL
+	visitor     *sketch.HLL
+	playback    *sketch.Histogram
+	quartiles   [4]int64 // clicks reaching 25/50/75/100% watched
+}
+
+// rollupAggregator buffers per ad-hour sketches in memory and periodically
+// merges them into click_rollups. HLL merges are idempotent maxima, so
+// concurrent consumers only need a row lock to combine their sketches.
+type rollupAggregator struct {
+	mu      sync.Mutex
+	buffers map[rollupKey]*rollupBuffer
+}
+
+func newRollupAggregator() *rollupAggregator {
+	return &rollupAggregator{buffers: make(map[rollupKey]*rollupBuffer)}
+}
+
+func newRollupBuffer() *rollupBuffer {
+	return &rollupBuffer{
+		ip:          sketch.NewHLL(),
+		fingerprint: sketch.NewHLL(),
+		visitor:     sketch.NewHLL(),
+		playback:    sketch.NewHistogram(sketch.PlaybackBuckets),
+	}
+}
+
+func newRollupKey(click models.Click) rollupKey {
+	return rollupKey{
+		adID:        click.AdID,
+		bucketStart: click.CreatedAt.UTC().Truncate(rollupBucket),
+	}
+}
+
+// add counts a click. Identity keys mirror the unique-user expressions in
+// analytics so sketch estimates match exact counts.
+func (buf *rollupBuffer) add(click models.Click) {
+	ipKey := "i:" + click.UserIP
+	fingerprintKey := ipKey
+	if click.Fingerprint != "" {
+		fingerprintKey = "f:" + click.Fingerprint
+	}
+	visitorKey := fingerprintKey
+	if click.VisitorID != "" {
+		visitorKey = "v:" + click.VisitorID
+	}
+
+	buf.clicks++
+	buf.ip.AddString(click.UserIP)
+	buf.fingerprint.AddString(fingerprintKey)
+	buf.visitor.AddString(visitorKey)
+	buf.playback.Add(click.PlaybackTimeSec)
+	for i, threshold := range []float64{25, 50, 75, 100} {
+		if click.WatchedPercent >= threshold {
+			buf.quartiles[i]++
+		}
+	}
+}
+
+// Add records a persisted click.
+func (a *rollupAggregator) Add(click models.Click) {
+	key := newRollupKey(click)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	buf, ok := a.buffers[key]
+	if !ok {
+		buf = newRollupBuffer()
+		a.buffers[key] = buf
+	}
+	buf.add(click)
+}
+
+// Run flushes buffered rollups on a fixed interval until ctx is done, and
+// once more on the way out.
+func (a *rollupAggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(rollupFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.flush()
+			return
+		case <-ticker.C:
+			a.flush()
+		}
+	}
+}
+
+func (a *rollupAggregator) flush() {
+	a.mu.Lock()
+	buffers := a.buffers
+	a.buffers = make(map[rollupKey]*rollupBuffer)
+	a.mu.Unlock()
+
+	for key, buf := range buffers {
+		if err := flushRollup(key, buf); err != nil {
+			observability.Logger.Error("Failed to flush click rollup",
+				zap.Error(err),
+				zap.Uint("ad_id", key.adID),
+				zap.Time("bucket_start", key.bucketStart))
+		}
+	}
+
+	if len(buffers) > 0 {
+		observability.Logger.Debug("Click rollups flushed", zap.Int("buckets", len(buffers)))
+	}
+}
+
+func flushRollup(key rollupKey, buf *rollupBuffer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return db.GormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Ensure the row exists, then lock it for the read-merge-write
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ClickRollup{AdID: key.adID, BucketStart: key.bucketStart}).Error; err != nil {
+			return err
+		}
+
+		var row models.ClickRollup
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("ad_id = ? AND bucket_start = ?", key.adID, key.bucketStart).
+			First(&row).Error; err != nil {
+			return err
+		}
+
+		ip, err := mergeSketch(row.IPSketch, buf.ip)
+		if err != nil {
+			return err
+		}
+		fingerprint, err := mergeSketch(row.FingerprintSketch, buf.fingerprint)
+		if err != nil {
+			return err
+		}
+		visitor, err := mergeSketch(row.VisitorSketch, buf.visitor)
+		if err != nil {
+			return err
+		}
+
+		playback := buf.playback
+		if len(row.PlaybackHistogram) > 0 {
+			existing := sketch.NewHistogram(sketch.PlaybackBuckets)
+			if err := existing.UnmarshalBinary(row.PlaybackHistogram); err != nil {
+				return err
+			}
+			if err := playback.Merge(existing); err != nil {
+				return err
+			}
+		}
+		playbackData, err := playback.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ClickRollup{}).
+			Where("ad_id = ? AND bucket_start = ?", key.adID, key.bucketStart).
+			Updates(map[string]interface{}{
+				"clicks":             gorm.Expr("clicks + ?", buf.clicks),
+				"ip_sketch":          ip,
+				"fingerprint_sketch": fingerprint,
+				"visitor_sketch":     visitor,
+				"playback_histogram": playbackData,
+				"watched25":          gorm.Expr("watched25 + ?", buf.quartiles[0]),
+				"watched50":          gorm.Expr("watched50 + ?", buf.quartiles[1]),
+				"watched75":          gorm.Expr("watched75 + ?", buf.quartiles[2]),
+				"watched100":         gorm.Expr("watched100 + ?", buf.quartiles[3]),
+			}).Error
+	})
+}
+
+// mergeSketch merges a buffered sketch into a stored one and returns the
+// encoded result.
+func mergeSketch(stored []byte, buffered *sketch.HLL) ([]byte, error) {
+	if len(stored) > 0 {
+		existing := &sketch.HLL{}
+		if err := existing.UnmarshalBinary(stored); err != nil {
+			return nil, err
+		}
+		buffered.Merge(existing)
+	}
+	return buffered.MarshalBinary()
+}
@@ -4,7 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"lystage-proj/internals/budget"
 	"lystage-proj/internals/db"
+	"lystage-proj/internals/enrich"
+	"lystage-proj/internals/fraud"
+	"lystage-proj/internals/lifecycle"
+	"lystage-proj/internals/live"
 	"lystage-proj/internals/models"
 	"lystage-proj/internals/observability"
 	"lystage-proj/internals/queue"
@@ -13,9 +18,14 @@ import (
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
 )
 
-func StartClickConsumer(broker, topic, group string) {
+// StartClickConsumer persists clicks from Kafka, scoring each with detector
+// first, and charges them to their ad's budget through ledger. Flagged
+// clicks are stored but not charged and left out of rollups and live
+// deltas. The consumer stops with background, after flushing its rollups.
+func StartClickConsumer(background *lifecycle.Group, broker, topic, group string, detector *fraud.Engine, ledger *budget.Ledger) {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     []string{broker},
 		GroupID:     group,
@@ -24,9 +34,22 @@ func StartClickConsumer(broker, topic, group string) {
 		MaxBytes:    10e6, // handle large batches
 	})
 
-	go func() {
+	rollups := newRollupAggregator()
+	background.Go(rollups.Run)
+
+	background.Go(func(ctx context.Context) {
+		defer func() {
+			if err := r.Close(); err != nil {
+				observability.Logger.Warn("Failed to close Kafka consumer", zap.Error(err))
+			}
+			rollups.flush()
+		}()
+
 		for {
-			msg, err := r.ReadMessage(context.Background())
+			msg, err := r.ReadMessage(ctx)
+			if ctx.Err() != nil {
+				return
+			}
 			if err != nil {
 				observability.Logger.Error("Kafka consumer read error", zap.Error(err))
 				continue
@@ -38,37 +61,99 @@ func StartClickConsumer(broker, topic, group string) {
 				continue
 			}
 
-			if err := saveClickEvent(e); err != nil {
+			click, err := saveClickEvent(e, detector)
+			if errors.Is(err, errDuplicateEvent) {
+				observability.Logger.Debug("Skipping redelivered click event", zap.String("event_id", e.EventID.String()))
+				continue
+			}
+			if err != nil {
 				observability.Logger.Error("Failed to save click event", zap.Error(err))
 				// Optionally: retry or send to DLQ
+				continue
+			}
+			if click.IsFraudulent {
+				continue
 			}
+			ledger.RecordClick(context.Background(), click.AdID, click.CreatedAt)
+			rollups.Add(*click)
+			live.Publish(live.Event{
+				AdID:            click.AdID,
+				PlaybackTimeSec: click.PlaybackTimeSec,
+				WatchedPercent:  click.WatchedPercent,
+				At:              click.CreatedAt,
+			})
 		}
-	}()
+	})
+}
+
+// errDuplicateEvent is returned for a click event that was already stored,
+// e.g. one redelivered by Kafka.
+var errDuplicateEvent = errors.New("click event already stored")
+
+// eventTime is when the API accepted the event. Events queued before
+// ReceivedAt was added fall back to the time they are consumed.
+func eventTime(e queue.ClickEvent) time.Time {
+	if e.ReceivedAt == 0 {
+		return time.Now()
+	}
+	return time.UnixMilli(e.ReceivedAt)
 }
 
-func saveClickEvent(e queue.ClickEvent) error {
+// saveClickEvent scores and stores a click. It is dated when the API
+// accepted it rather than when it is consumed, so a backlog neither
+// bunches clicks into the fraud rules' windows nor shifts them in
+// analytics, spend or flights. Only clicks actually stored are counted by
+// the rules.
+func saveClickEvent(e queue.ClickEvent, detector *fraud.Engine) (*models.Click, error) {
 	if e.AdID == 0 || e.EventID == uuid.Nil {
-		return errors.New("invalid click event data")
+		return nil, errors.New("invalid click event data")
 	}
 
+	dims := enrich.Resolve(e.Agent, e.UserIP)
+
 	click := models.Click{
 		EventID:         e.EventID,
 		AdID:            e.AdID,
+		ImpressionID:    e.ImpressionID,
+		VariantID:       e.VariantID,
 		UserIP:          e.UserIP,
 		UserAgent:       e.Agent,
+		VisitorID:       e.VisitorID,
+		Fingerprint:     e.Fingerprint,
 		PlaybackTimeSec: e.PlayTime,
 		WatchedPercent:  e.Watched,
-		IsFraudulent:    false, // Hook for fraud detection
-		CreatedAt:       time.Now(),
+		DeviceType:      dims.DeviceType,
+		Browser:         dims.Browser,
+		OS:              dims.OS,
+		Country:         dims.Country,
+		Region:          dims.Region,
+		CreatedAt:       eventTime(e),
+	}
+
+	verdict := detector.Apply(&click, dims.IsBot)
+
+	result := db.GormDB.
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).
+		Create(&click)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errDuplicateEvent
 	}
+	detector.Record(&click, verdict)
 
-	if err := db.GormDB.Create(&click).Error; err != nil {
-		return err
+	if verdict.Fraudulent {
+		observability.Logger.Info("Click flagged as fraudulent",
+			zap.Uint("ad_id", e.AdID),
+			zap.String("event_id", e.EventID.String()),
+			zap.Float64("score", verdict.Score),
+			zap.Strings("reasons", verdict.Reasons))
 	}
 
 	observability.Logger.Info("Click stored in DB",
 		zap.Uint("ad_id", e.AdID),
 		zap.String("event_id", e.EventID.String()),
 	)
-	return nil
+	return &click, nil
 }